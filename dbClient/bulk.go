@@ -0,0 +1,98 @@
+package dbClient
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jifuy/commongo/dbClient/dm"
+	"github.com/jifuy/commongo/loging"
+)
+
+// BulkLoad 批量装载, 达梦走 DmConnection.BulkLoad 数组绑定, 其他库按批在事务中逐行插入
+func BulkLoad(ctx context.Context, logging loging.Logger, SqlDb *sql.DB, table string, rows dm.RowSource, opts dm.BulkLoadOptions) (*dm.BulkLoadResult, error) {
+	conn, err := SqlDb.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var result *dm.BulkLoadResult
+	if _, ok := SqlDb.Driver().(*dm.DmDriver); ok {
+		err = conn.Raw(func(driverConn interface{}) error {
+			dc, ok := driverConn.(*dm.DmConnection)
+			if !ok {
+				return fmt.Errorf("unexpected dm driver conn %T", driverConn)
+			}
+			result, err = dc.BulkLoad(ctx, table, rows, opts)
+			return err
+		})
+	} else {
+		result, err = bulkLoadGeneric(ctx, conn, table, rows, opts)
+	}
+	if result != nil {
+		logging.Infof("[Sql] BulkLoad %s loaded:%d failed:%d", table, result.Loaded, len(result.Errors))
+	}
+	if err != nil {
+		logging.Error("[Sql] BulkLoad Error : " + err.Error())
+	}
+	return result, err
+}
+
+func bulkLoadGeneric(ctx context.Context, conn *sql.Conn, table string, rows dm.RowSource, opts dm.BulkLoadOptions) (*dm.BulkLoadResult, error) {
+	if len(opts.Columns) == 0 {
+		return nil, fmt.Errorf("bulk load %s without columns", table)
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 1000
+	}
+	query := "INSERT INTO " + table + "(" + strings.Join(opts.Columns, ",") + ") VALUES(" +
+		strings.TrimSuffix(strings.Repeat("?,", len(opts.Columns)), ",") + ")"
+	result := &dm.BulkLoadResult{}
+
+	var row int64
+	for eof := false; !eof; {
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return result, err
+		}
+		stmt, err := tx.PrepareContext(ctx, query)
+		if err != nil {
+			_ = tx.Rollback()
+			return result, err
+		}
+		var loaded int64
+		for i := 0; i < opts.BatchSize; i++ {
+			values, err := rows()
+			if err == io.EOF {
+				eof = true
+				break
+			}
+			if err != nil {
+				_ = tx.Rollback()
+				return result, err
+			}
+			if _, err = stmt.ExecContext(ctx, values...); err != nil {
+				result.Errors = append(result.Errors, dm.BulkRowError{Row: row, Values: values, Err: err})
+				if opts.MaxErrors >= 0 && len(result.Errors) > opts.MaxErrors {
+					_ = tx.Rollback()
+					return result, fmt.Errorf("bulk load aborted after %d error rows: %w", len(result.Errors), err)
+				}
+			} else {
+				loaded++
+			}
+			row++
+		}
+		_ = stmt.Close()
+		if err = tx.Commit(); err != nil {
+			return result, err
+		}
+		result.Loaded += loaded
+		if opts.Progress != nil {
+			opts.Progress(result.Loaded, int64(len(result.Errors)))
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,97 @@
+package dbClient
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/jifuy/commongo/dbClient/dm"
+	"github.com/jifuy/commongo/dbClient/dm/dmtest"
+	"github.com/jifuy/commongo/loging"
+)
+
+func TestBulkLoadDm(t *testing.T) {
+	srv, err := dmtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	// 整批中有一行违反唯一约束时, 整批报错并逐行重试
+	srv.HandleFunc(func(q *dmtest.Query) *dmtest.Result {
+		for _, args := range q.Args {
+			if args[0] == int64(3) {
+				return dmtest.Errorf(-6602, "violate unique constraint")
+			}
+		}
+		return nil
+	})
+
+	db, err := sql.Open("dm", srv.DSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	rows := make([][]interface{}, 5)
+	for i := range rows {
+		rows[i] = []interface{}{i, "name"}
+	}
+	result, err := BulkLoad(context.Background(), loging.NewStd(), db, "t", dm.SliceRows(rows),
+		dm.BulkLoadOptions{Columns: []string{"id", "name"}, BatchSize: 4, MaxErrors: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Loaded != 4 || len(result.Errors) != 1 || result.Errors[0].Row != 3 {
+		t.Fatalf("result = %+v", result)
+	}
+}
+
+func TestBulkLoadMaxErrors(t *testing.T) {
+	srv, err := dmtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	srv.HandleFunc(func(q *dmtest.Query) *dmtest.Result {
+		for _, args := range q.Args {
+			if args[0] == int64(3) {
+				return dmtest.Errorf(-6602, "violate unique constraint")
+			}
+		}
+		return nil
+	})
+
+	// 连接串中的 batchAllowMaxErrors 不影响 MaxErrors
+	db, err := sql.Open("dm", srv.DSN("batchAllowMaxErrors=10"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	rows := [][]interface{}{{0, "a"}, {1, "b"}, {2, "c"}, {3, "d"}}
+	opts := dm.BulkLoadOptions{Columns: []string{"id", "name"}, BatchSize: 2}
+
+	// MaxErrors 为 0 时达梦和其他数据库都在第一个错误行中止, 回滚当前批, Loaded 只含已提交的第一批
+	result, err := BulkLoad(context.Background(), loging.NewStd(), db, "t", dm.SliceRows(rows), opts)
+	if err == nil || len(result.Errors) != 1 || result.Loaded != 2 {
+		t.Fatalf("dm: result = %+v, err = %v", result, err)
+	}
+	var tx []string
+	for _, q := range srv.Queries() {
+		if q.SQL == "COMMIT" || q.SQL == "ROLLBACK" {
+			tx = append(tx, q.SQL)
+		}
+	}
+	if len(tx) != 2 || tx[0] != "COMMIT" || tx[1] != "ROLLBACK" {
+		t.Fatalf("dm: transactions = %v", tx)
+	}
+
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	result, err = bulkLoadGeneric(context.Background(), conn, "t", dm.SliceRows(rows), opts)
+	if err == nil || len(result.Errors) != 1 || result.Loaded != 2 {
+		t.Fatalf("generic: result = %+v, err = %v", result, err)
+	}
+}
@@ -739,7 +739,7 @@ func (dm_build_234 *dm_build_2) dm_build_233(dm_build_235 []interface{}, dm_buil
 			lob = l.lob
 		}
 		if &lob != nil && lob.canOptimized(dm_build_234.dm_build_6) {
-			dm_build_235[dm_build_237] = &lobCtl{lob.buildCtlData()}
+			dm_build_235[dm_build_237] = lobCtl{lob.buildCtlData()}
 			dm_build_238 = false
 		}
 	} else {
@@ -768,6 +768,9 @@ func (dm_build_240 *dm_build_2) dm_build_239(dm_build_241 *DmStatement, dm_build
 			return err
 		}
 	}
+	if b, ok := dm_build_244.(*offRowReaderBinder); ok && b.err != nil {
+		return b.err
+	}
 	return nil
 }
 
@@ -0,0 +1,229 @@
+package dm
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const bulkBatchSizeDef = 1000
+
+// RowSource 逐行提供数据, 没有更多数据时返回 io.EOF
+type RowSource func() ([]interface{}, error)
+
+// SliceRows 把内存中的行包装成 RowSource
+func SliceRows(rows [][]interface{}) RowSource {
+	i := 0
+	return func() ([]interface{}, error) {
+		if i >= len(rows) {
+			return nil, io.EOF
+		}
+		i++
+		return rows[i-1], nil
+	}
+}
+
+// BulkLoadOptions 批量装载参数
+type BulkLoadOptions struct {
+	Columns   []string // 目标列, 顺序与行数据一致
+	BatchSize int      // 每批提交的行数, 默认 1000
+	// MaxErrors 允许跳过的错误行数, 超过后中止装载并回滚当前批; 0 遇到第一个错误行即中止, 小于 0 不限制.
+	// 各数据库含义相同, 不使用连接串中的 batchAllowMaxErrors
+	MaxErrors int
+	Progress  func(loaded, failed int64) // 每批完成后回调
+}
+
+// BulkRowError 装载失败的行
+type BulkRowError struct {
+	Row    int64 // 在数据源中的行号, 从 0 开始
+	Values []interface{}
+	Err    error
+}
+
+// BulkLoadResult 装载结果
+type BulkLoadResult struct {
+	Loaded int64 // 已完成批次的行数, 不含中止时回滚的批次
+	Errors []BulkRowError
+}
+
+// BulkLoad 按批数组绑定插入 table, 出错的批次逐行重试以收集错误行.
+// 通过 sql.Conn.Raw 取得 *DmConnection 后调用. 连接不在事务中时每批单独提交, 中止时回滚当前批;
+// 在调用方的事务中执行时不提交, 中止后由调用方回滚.
+func (dc *DmConnection) BulkLoad(ctx context.Context, table string, rows RowSource, opts BulkLoadOptions) (*BulkLoadResult, error) {
+	if len(opts.Columns) == 0 {
+		return nil, fmt.Errorf("dm: bulk load %s without columns", table)
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = bulkBatchSizeDef
+	}
+
+	query := "INSERT INTO " + table + "(" + strings.Join(opts.Columns, ",") + ") VALUES(" +
+		strings.TrimSuffix(strings.Repeat("?,", len(opts.Columns)), ",") + ")"
+	stmt, err := dc.prepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.close()
+
+	l := &bulkLoader{dc: dc, stmt: stmt, opts: opts, result: &BulkLoadResult{}, commit: dc.autoCommit}
+	if l.commit {
+		dc.autoCommit = false
+		defer func() { dc.autoCommit = true }()
+	}
+	batch := make([][]driver.Value, 0, opts.BatchSize)
+	orig := make([][]interface{}, 0, opts.BatchSize)
+	var start, next int64
+	for {
+		row, err := rows()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return l.result, err
+		}
+		values, err := l.convert(row)
+		if err != nil {
+			if err = l.fail(next, row, err); err != nil {
+				return l.result, err
+			}
+			next++
+			continue
+		}
+		if len(batch) == 0 {
+			start = next
+		}
+		batch = append(batch, values)
+		orig = append(orig, row)
+		next++
+		if len(batch) == opts.BatchSize {
+			if err = l.flush(ctx, start, batch, orig); err != nil {
+				return l.result, err
+			}
+			batch, orig = batch[:0], orig[:0]
+		}
+	}
+	if len(batch) > 0 {
+		if err = l.flush(ctx, start, batch, orig); err != nil {
+			return l.result, err
+		}
+	}
+	return l.result, nil
+}
+
+type bulkLoader struct {
+	dc     *DmConnection
+	stmt   *DmStatement
+	opts   BulkLoadOptions
+	result *BulkLoadResult
+	commit bool // 每批提交, 连接原本为自动提交
+}
+
+// convert 与 CheckNamedValue 一致地转换 Go 值
+func (l *bulkLoader) convert(row []interface{}) ([]driver.Value, error) {
+	if len(row) != len(l.opts.Columns) {
+		return nil, fmt.Errorf("dm: row has %d values, want %d", len(row), len(l.opts.Columns))
+	}
+	cvt := converter{l.dc, false}
+	values := make([]driver.Value, len(row))
+	for i, v := range row {
+		dv, err := cvt.ConvertValue(v)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = dv
+	}
+	return values, nil
+}
+
+func (l *bulkLoader) fail(row int64, values []interface{}, err error) error {
+	l.result.Errors = append(l.result.Errors, BulkRowError{Row: row, Values: values, Err: err})
+	if l.opts.MaxErrors < 0 || len(l.result.Errors) <= l.opts.MaxErrors {
+		return nil
+	}
+	return fmt.Errorf("dm: bulk load aborted after %d error rows: %w", len(l.result.Errors), err)
+}
+
+// execArray 数组绑定执行一批, 不走 batchType=2 的逐行路径, 保证失败时整批回退
+func (l *bulkLoader) execArray(batch [][]driver.Value) error {
+	bytes := make([][]interface{}, 0, len(batch))
+	for _, row := range batch {
+		b, err := encodeArgs(l.stmt, row)
+		if err != nil {
+			return err
+		}
+		bytes = append(bytes, b)
+	}
+	execInfo, err := l.dc.Access.Dm_build_98(l.stmt, bytes, l.stmt.preExec)
+	if err != nil {
+		return err
+	}
+	l.stmt.execInfo = execInfo
+	return nil
+}
+
+func (l *bulkLoader) flush(ctx context.Context, start int64, batch [][]driver.Value, orig [][]interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := l.dc.watchCancel(ctx); err != nil {
+		return err
+	}
+	defer l.dc.finish()
+
+	loaded, err := l.insert(start, batch, orig)
+	if l.commit {
+		if err != nil {
+			// 中止时回滚当前批已插入的行, 与其他数据库的事务语义一致
+			if rerr := l.dc.Access.Rollback(); rerr != nil {
+				return rerr
+			}
+			l.dc.trxFinish = true
+			return err
+		}
+		if err = l.dc.Access.Commit(); err != nil {
+			return err
+		}
+		l.dc.trxFinish = true
+	} else if err != nil {
+		return err
+	}
+	l.result.Loaded += loaded
+	if l.opts.Progress != nil {
+		l.opts.Progress(l.result.Loaded, int64(len(l.result.Errors)))
+	}
+	return nil
+}
+
+// insert 插入一批, 返回成功的行数
+func (l *bulkLoader) insert(start int64, batch [][]driver.Value, orig [][]interface{}) (int64, error) {
+	var loaded int64
+	if err := l.execArray(batch); err != nil {
+		if IsRetryable(err) {
+			return 0, err
+		}
+		// 整批失败时逐行执行, 找出出错的行
+		for i, row := range batch {
+			if err := l.stmt.executeInner(row, Dm_build_357); err != nil {
+				if err = l.fail(start+int64(i), orig[i], err); err != nil {
+					return 0, err
+				}
+				continue
+			}
+			loaded++
+		}
+		return loaded, nil
+	}
+	// continueBatchOnError 时服务端跳过错误行, 影响行数记为 -3
+	for i, n := range l.stmt.execInfo.updateCounts {
+		if n == -3 {
+			if err := l.fail(start+int64(i), orig[i], EC_BP_WITH_ERROR); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		loaded++
+	}
+	return loaded, nil
+}
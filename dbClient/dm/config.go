@@ -0,0 +1,417 @@
+package dm
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jifuy/commongo/dbClient/dm/util"
+)
+
+// DSN 参数类型
+const (
+	paramString = iota
+	paramBool
+	paramInt
+	paramEnum
+)
+
+type paramSpec struct {
+	name  string // 规范写法
+	kind  int
+	min   int
+	max   int
+	enums []string // paramEnum 可选值, 同时允许 min~max 的数字
+}
+
+// dsnParams 小写 key -> 参数说明, 与 setAttributes 中的取值范围保持一致
+var dsnParams = map[string]paramSpec{}
+
+func init() {
+	maxInt := int(INT32_MAX)
+	specs := []paramSpec{
+		{name: UrlKey}, {name: HostKey}, {name: UserKey}, {name: PasswordKey},
+		{name: LoginCertificateKey}, {name: CipherPathKey}, {name: KeywordsKey},
+		{name: AppNameKey}, {name: OsNameKey}, {name: SchemaKey},
+		{name: SslFilesPathKey}, {name: SslCertPathKey}, {name: SslKeyPathKey},
+		{name: KerberosLoginConfPathKey}, {name: UKeyNameKey}, {name: UKeyPinKey},
+		{name: LogDirKey}, {name: StatDirKey}, {name: AddressRemapKey}, {name: UserRemapKey},
+		{name: LoginPrimary}, {name: PrimaryKey}, {name: LanguageKey}, {name: DatabaseProductNameKey},
+		{name: "confPath"}, {name: "svcConfPath"},
+
+		{name: RwStandbyKey, kind: paramBool}, {name: IsCompressKey, kind: paramBool},
+		{name: EnRsCacheKey, kind: paramBool}, {name: LoginDscCtrlKey, kind: paramBool},
+		{name: LoginEncryptKey, kind: paramBool}, {name: CommunicationEncryptKey, kind: paramBool},
+		{name: Dec2DoubleKey, kind: paramBool}, {name: RwSeparateKey, kind: paramBool},
+		{name: RwAutoDistributeKey, kind: paramBool}, {name: RwHAKey, kind: paramBool},
+		{name: RwIgnoreSqlKey, kind: paramBool}, {name: CompatibleOraKey, kind: paramBool},
+		{name: MppLocalKey, kind: paramBool}, {name: ContinueBatchOnErrorKey, kind: paramBool},
+		{name: EscapeProcessKey, kind: paramBool}, {name: AutoCommitKey, kind: paramBool},
+		{name: IgnoreCaseKey, kind: paramBool}, {name: AlwayseAllowCommitKey, kind: paramBool},
+		{name: BatchNotOnCallKey, kind: paramBool}, {name: IsBdtaRSKey, kind: paramBool},
+		{name: ColumnNameUpperCaseKey, kind: paramBool}, {name: StatEnableKey, kind: paramBool},
+		{name: DirectKey, kind: paramBool},
+
+		{name: PortKey, kind: paramInt, max: 65535},
+		{name: CompressKey, kind: paramInt, max: 2},
+		{name: CompressIdKey, kind: paramInt, max: 1},
+		{name: TimeZoneKey, kind: paramInt, min: -720, max: 720},
+		{name: RsCacheSizeKey, kind: paramInt, max: maxInt},
+		{name: RsRefreshFreqKey, kind: paramInt, max: maxInt},
+		{name: LoginModeKey, kind: paramInt, max: 4},
+		{name: LoginStatusKey, kind: paramInt, max: maxInt},
+		{name: SwitchTimesKey, kind: paramInt, max: maxInt},
+		{name: SwitchIntervalKey, kind: paramInt, max: maxInt},
+		{name: EpSelectorKey, kind: paramInt, max: 1},
+		{name: RwPercentKey, kind: paramInt, max: 100},
+		{name: RwStandbyRecoverTimeKey, kind: paramInt, max: maxInt},
+		{name: DoSwitchKey, kind: paramInt, max: 2},
+		{name: DbAliveCheckFreqKey, kind: paramInt, max: maxInt},
+		{name: SocketTimeoutKey, kind: paramInt, max: maxInt},
+		{name: ConnectTimeoutKey, kind: paramInt, max: maxInt},
+		{name: SessionTimeoutKey, kind: paramInt, max: maxInt},
+		{name: BatchAllowMaxErrorsKey, kind: paramInt, max: maxInt},
+		{name: MaxRowsKey, kind: paramInt, max: maxInt},
+		{name: RowPrefetchKey, kind: paramInt, max: maxInt},
+		{name: BufPrefetchKey, kind: paramInt, min: int(Dm_build_336), max: int(Dm_build_337)},
+		{name: LobModeKey, kind: paramInt, min: 1, max: 2},
+		{name: StmtPoolSizeKey, kind: paramInt, max: maxInt},
+		{name: BatchTypeKey, kind: paramInt, min: 1, max: 2},
+		{name: LogBufferPoolSizeKey, kind: paramInt, min: 1, max: maxInt},
+		{name: LogBufferSizeKey, kind: paramInt, min: 1, max: maxInt},
+		{name: LogFlushFreqKey, kind: paramInt, min: 1, max: maxInt},
+		{name: LogFlusherQueueSizeKey, kind: paramInt, min: 1, max: maxInt},
+		{name: StatFlushFreqKey, kind: paramInt, min: 1, max: maxInt},
+		{name: StatHighFreqSqlCountKey, kind: paramInt, max: 1000},
+		{name: StatSlowSqlCountKey, kind: paramInt, max: 1000},
+		{name: StatSqlMaxCountKey, kind: paramInt, max: 100000},
+
+		{name: ClusterKey, kind: paramEnum, min: 1, max: 0, enums: []string{"DSC", "RW", "DW", "MPP", "NORMAL"}},
+		{name: CompatibleModeKey, kind: paramEnum, max: 2, enums: []string{"oracle", "mysql"}},
+		{name: OsAuthTypeKey, kind: paramEnum, max: 4, enums: []string{"ON", "OFF", "SYSDBA", "SYSAUDITOR", "SYSSSO", "AUTO"}},
+		{name: ColumnNameCaseKey, kind: paramEnum, min: 1, max: 0, enums: []string{"upper", "lower"}},
+		{name: StatSqlRemoveModeKey, kind: paramEnum, min: 1, max: 2, enums: []string{"oldest", "eldest", "latest"}},
+		{name: LogLevelKey, kind: paramEnum, min: LOG_OFF, max: LOG_INFO, enums: []string{"debug", "info", "sql", "warn", "error", "off", "all"}},
+	}
+	for _, s := range specs {
+		dsnParams[strings.ToLower(s.name)] = s
+	}
+}
+
+// checkParam 校验单个 DSN 参数, 未知 key 或非法取值返回错误
+func checkParam(key, value string) (string, error) {
+	spec, ok := dsnParams[strings.ToLower(key)]
+	if !ok {
+		return "", fmt.Errorf("dm: unknown dsn parameter %q", key)
+	}
+	switch spec.kind {
+	case paramBool:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return "", fmt.Errorf("dm: parameter %s=%q is not a bool", spec.name, value)
+		}
+	case paramInt:
+		i, err := strconv.Atoi(value)
+		if err != nil || i < spec.min || i > spec.max {
+			return "", fmt.Errorf("dm: parameter %s=%q out of range [%d, %d]", spec.name, value, spec.min, spec.max)
+		}
+	case paramEnum:
+		for _, e := range spec.enums {
+			if util.StringUtil.EqualsIgnoreCase(e, value) {
+				return spec.name, nil
+			}
+		}
+		if i, err := strconv.Atoi(value); err == nil && i >= spec.min && i <= spec.max {
+			return spec.name, nil
+		}
+		return "", fmt.Errorf("dm: parameter %s=%q must be one of %v", spec.name, value, spec.enums)
+	}
+	return spec.name, nil
+}
+
+// Config 达梦连接配置, 可代替手写 DSN
+type Config struct {
+	Host     string // 主机或 dm_svc.conf 中的服务名
+	Port     int
+	User     string
+	Password string
+	Schema   string
+	AppName  string
+
+	ConnectTimeout time.Duration // 毫秒精度
+	SocketTimeout  time.Duration // 秒精度
+	SessionTimeout time.Duration // 秒精度
+
+	// 读写分离
+	RwSeparate bool
+	RwPercent  int
+
+	// 故障切换
+	SwitchTimes    int
+	SwitchInterval time.Duration
+
+	// SSL 证书
+	SslCertPath string
+	SslKeyPath  string
+
+	// 其余 DSN 参数, key 同 o.go 中的 *Key 常量
+	Params map[string]string
+}
+
+// Option 配置项
+type Option func(*Config)
+
+// NewConfig 创建配置, 默认连接 localhost:5236
+func NewConfig(opts ...Option) *Config {
+	cfg := &Config{Host: hostDef, Port: int(portDef)}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+func WithAddr(host string, port int) Option {
+	return func(c *Config) { c.Host, c.Port = host, port }
+}
+
+func WithUser(user, password string) Option {
+	return func(c *Config) { c.User, c.Password = user, password }
+}
+
+func WithSchema(schema string) Option {
+	return func(c *Config) { c.Schema = schema }
+}
+
+func WithAppName(name string) Option {
+	return func(c *Config) { c.AppName = name }
+}
+
+func WithTimeout(connect, socket time.Duration) Option {
+	return func(c *Config) { c.ConnectTimeout, c.SocketTimeout = connect, socket }
+}
+
+// WithRwSeparate 开启读写分离, percent 为分发到主库的事务比例
+func WithRwSeparate(percent int) Option {
+	return func(c *Config) { c.RwSeparate, c.RwPercent = true, percent }
+}
+
+// WithSwitch 连接失败时的切换次数和间隔
+func WithSwitch(times int, interval time.Duration) Option {
+	return func(c *Config) { c.SwitchTimes, c.SwitchInterval = times, interval }
+}
+
+func WithSSL(certPath, keyPath string) Option {
+	return func(c *Config) { c.SslCertPath, c.SslKeyPath = certPath, keyPath }
+}
+
+// WithParam 设置其余 DSN 参数, 在 Validate 时校验
+func WithParam(key, value string) Option {
+	return func(c *Config) {
+		if c.Params == nil {
+			c.Params = make(map[string]string)
+		}
+		c.Params[key] = value
+	}
+}
+
+// params 合并类型化字段和 Params, key 为规范写法
+func (c *Config) params() (map[string]string, error) {
+	m := make(map[string]string, len(c.Params)+10)
+	for k, v := range c.Params {
+		name, err := checkParam(k, v)
+		if err != nil {
+			return nil, err
+		}
+		switch strings.ToLower(name) {
+		case strings.ToLower(HostKey), strings.ToLower(PortKey), strings.ToLower(UserKey), strings.ToLower(PasswordKey):
+			return nil, fmt.Errorf("dm: parameter %s must be set by Config field", name)
+		}
+		m[name] = v
+	}
+	set := func(key, value string) error {
+		if _, err := checkParam(key, value); err != nil {
+			return err
+		}
+		m[key] = value
+		return nil
+	}
+	ms := func(d time.Duration) string { return strconv.FormatInt(d.Milliseconds(), 10) }
+
+	var err error
+	add := func(key, value string) {
+		if err == nil {
+			err = set(key, value)
+		}
+	}
+	if c.Schema != "" {
+		add(SchemaKey, c.Schema)
+	}
+	if c.AppName != "" {
+		add(AppNameKey, c.AppName)
+	}
+	if c.ConnectTimeout > 0 {
+		add(ConnectTimeoutKey, ms(c.ConnectTimeout))
+	}
+	if c.SocketTimeout > 0 {
+		add(SocketTimeoutKey, strconv.Itoa(int(c.SocketTimeout/time.Second)))
+	}
+	if c.SessionTimeout > 0 {
+		add(SessionTimeoutKey, strconv.Itoa(int(c.SessionTimeout/time.Second)))
+	}
+	if c.RwSeparate {
+		add(RwSeparateKey, "true")
+		add(RwPercentKey, strconv.Itoa(c.RwPercent))
+	}
+	if c.SwitchTimes > 0 {
+		add(SwitchTimesKey, strconv.Itoa(c.SwitchTimes))
+	}
+	if c.SwitchInterval > 0 {
+		add(SwitchIntervalKey, ms(c.SwitchInterval))
+	}
+	if c.SslCertPath != "" {
+		add(SslCertPathKey, c.SslCertPath)
+	}
+	if c.SslKeyPath != "" {
+		add(SslKeyPathKey, c.SslKeyPath)
+	}
+	return m, err
+}
+
+// Validate 校验配置, 未知参数和越界取值都会报错
+func (c *Config) Validate() error {
+	if c.Host == "" {
+		return fmt.Errorf("dm: host is required")
+	}
+	if c.Port < 0 || c.Port > 65535 {
+		return fmt.Errorf("dm: port %d out of range", c.Port)
+	}
+	if (c.SslCertPath == "") != (c.SslKeyPath == "") {
+		return fmt.Errorf("dm: sslCertPath and sslKeyPath must be set together")
+	}
+	_, err := c.params()
+	return err
+}
+
+// FormatDSN 校验配置后生成 DSN, 参数按 key 排序
+func (c *Config) FormatDSN() (string, error) {
+	if err := c.Validate(); err != nil {
+		return "", err
+	}
+	params, err := c.params()
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	buf.WriteString("dm://")
+	if c.User != "" {
+		buf.WriteString(url.UserPassword(c.User, c.Password).String())
+		buf.WriteByte('@')
+	}
+	if c.Port > 0 {
+		buf.WriteString(net.JoinHostPort(c.Host, strconv.Itoa(c.Port)))
+	} else {
+		buf.WriteString(c.Host)
+	}
+
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for i, k := range keys {
+		if i == 0 {
+			buf.WriteByte('?')
+		} else {
+			buf.WriteByte('&')
+		}
+		buf.WriteString(url.QueryEscape(k))
+		buf.WriteByte('=')
+		buf.WriteString(url.QueryEscape(params[k]))
+	}
+	return buf.String(), nil
+}
+
+// ParseDSN 解析 DSN 为 Config, 未知参数报错
+func ParseDSN(dsn string) (*Config, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "dm" {
+		return nil, DSN_INVALID_SCHEMA
+	}
+	cfg := &Config{Host: u.Host}
+	if u.User != nil {
+		cfg.User = u.User.Username()
+		cfg.Password, _ = u.User.Password()
+	}
+	if host, port, err := net.SplitHostPort(u.Host); err == nil {
+		cfg.Host = host
+		if cfg.Port, err = strconv.Atoi(port); err != nil {
+			return nil, fmt.Errorf("dm: invalid port %q", port)
+		}
+	}
+
+	q := u.Query()
+	for k := range q {
+		v := q.Get(k)
+		name, err := checkParam(k, v)
+		if err != nil {
+			return nil, err
+		}
+		d, _ := strconv.Atoi(v)
+		switch name {
+		case SchemaKey:
+			cfg.Schema = v
+		case AppNameKey:
+			cfg.AppName = v
+		case ConnectTimeoutKey:
+			cfg.ConnectTimeout = time.Duration(d) * time.Millisecond
+		case SocketTimeoutKey:
+			cfg.SocketTimeout = time.Duration(d) * time.Second
+		case SessionTimeoutKey:
+			cfg.SessionTimeout = time.Duration(d) * time.Second
+		case RwSeparateKey:
+			cfg.RwSeparate, _ = strconv.ParseBool(v)
+		case RwPercentKey:
+			cfg.RwPercent = d
+		case SwitchTimesKey:
+			cfg.SwitchTimes = d
+		case SwitchIntervalKey:
+			cfg.SwitchInterval = time.Duration(d) * time.Millisecond
+		case SslCertPathKey:
+			cfg.SslCertPath = v
+		case SslKeyPathKey:
+			cfg.SslKeyPath = v
+		default:
+			if cfg.Params == nil {
+				cfg.Params = make(map[string]string)
+			}
+			cfg.Params[name] = v
+		}
+	}
+	// rwPercent 只在开启读写分离时生效
+	if !cfg.RwSeparate && cfg.RwPercent != 0 {
+		WithParam(RwPercentKey, strconv.Itoa(cfg.RwPercent))(cfg)
+		cfg.RwPercent = 0
+	}
+	return cfg, cfg.Validate()
+}
+
+// NewConnector 校验配置并创建 DmConnector, 可用于 sql.OpenDB
+func NewConnector(cfg *Config) (*DmConnector, error) {
+	dsn, err := cfg.FormatDSN()
+	if err != nil {
+		return nil, err
+	}
+	c, err := globalDmDriver.openConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	c.config = cfg
+	return c, nil
+}
@@ -0,0 +1,67 @@
+package dm
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestConfigRoundTrip(t *testing.T) {
+	cfg := NewConfig(
+		WithAddr("192.168.1.10", 5236),
+		WithUser("SYSDBA", "p@ss:word"),
+		WithSchema("ALARM"),
+		WithTimeout(3*time.Second, 10*time.Second),
+		WithRwSeparate(30),
+		WithSwitch(3, 500*time.Millisecond),
+		WithParam("compress", "1"),
+		WithParam(ClusterKey, "rw"),
+	)
+	dsn, err := cfg.FormatDSN()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ParseDSN(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Params = map[string]string{CompressKey: "1", ClusterKey: "rw"}
+	if !reflect.DeepEqual(cfg, got) {
+		t.Fatalf("round trip mismatch\nwant %+v\ngot  %+v\ndsn  %s", cfg, got, dsn)
+	}
+	if again, _ := got.FormatDSN(); again != dsn {
+		t.Fatalf("FormatDSN not stable: %s != %s", again, dsn)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	for _, opt := range []Option{
+		WithParam("switchTime", "3"),
+		WithParam(CompressKey, "5"),
+		WithParam(RwSeparateKey, "yes"),
+		WithParam(ColumnNameCaseKey, "camel"),
+		WithParam(HostKey, "127.0.0.1"),
+		WithSSL("client-cert.pem", ""),
+	} {
+		if err := NewConfig(opt).Validate(); err == nil {
+			t.Errorf("expected error for %+v", NewConfig(opt))
+		}
+		if dsn, err := NewConfig(WithAddr("127.0.0.1", 5236), opt).FormatDSN(); err == nil {
+			t.Errorf("FormatDSN = %s, expected error", dsn)
+		}
+	}
+	if _, err := ParseDSN("dm://SYSDBA:SYSDBA@localhost:5236?rwSeperate=true"); err == nil {
+		t.Error("expected unknown parameter error")
+	}
+}
+
+func TestBuildDSNFallback(t *testing.T) {
+	// Config 不识别的参数仍可连接, BuildDSN 保留连接超时
+	c, err := new(DmDriver).openConnector("dm://SYSDBA:SYSDBA@127.0.0.1:5236?connectTimeout=3000&myOwnProp=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dsn := c.BuildDSN(); dsn != "dm://SYSDBA:SYSDBA@127.0.0.1:5236?timeout=3000" {
+		t.Fatalf("dsn = %s", dsn)
+	}
+}
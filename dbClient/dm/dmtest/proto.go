@@ -0,0 +1,236 @@
+package dmtest
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// 消息头, 所有整数均为小端
+const (
+	headerSize = 64
+
+	offStmtID   = 0
+	offCmd      = 4
+	offBodyLen  = 6
+	offRetCode  = 10
+	offChecksum = 19
+	offCmdData  = 20
+)
+
+// 命令字
+const (
+	cmdLogin      int16 = 1
+	cmdAllocStmt  int16 = 3
+	cmdFreeStmt   int16 = 4
+	cmdPrepare    int16 = 5
+	cmdExecute    int16 = 6
+	cmdFetch      int16 = 7
+	cmdCommit     int16 = 8
+	cmdRollback   int16 = 9
+	cmdExecute2   int16 = 13
+	cmdPutData    int16 = 14
+	cmdLobLength  int16 = 29
+	cmdLobWrite   int16 = 30
+	cmdLobTrunc   int16 = 31
+	cmdLobRead    int16 = 32
+	cmdMoreResult int16 = 44
+	cmdPreExec    int16 = 90
+	cmdStartup    int16 = 200
+)
+
+// 执行返回的语句类型
+const (
+	sqlTypeInsert int16 = 157
+	sqlTypeSelect int16 = 160
+	sqlTypeProc   int16 = 162
+	sqlTypeSchema int16 = 153
+)
+
+// 列类型, 与驱动中的类型编号一致
+const (
+	Char      int32 = 0
+	Varchar   int32 = 2
+	Bit       int32 = 3
+	TinyInt   int32 = 5
+	SmallInt  int32 = 6
+	Int       int32 = 7
+	BigInt    int32 = 8
+	Real      int32 = 10
+	Double    int32 = 11
+	Blob      int32 = 12
+	Binary    int32 = 17
+	Varbinary int32 = 18
+	Clob      int32 = 19
+	typeNull  int32 = 25
+)
+
+const (
+	itemFlagLob       = 0x02
+	itemFlagRecommend = 0x08
+
+	dataNull    uint16 = 0xFFFE
+	dataLong    uint16 = 0xFFFF
+	dataLobCtl  uint16 = 0xFFFB
+	lobOffRow   byte   = 2
+	lobHeadSize        = 21
+
+	lobChunkEnd = 0x02
+)
+
+var errShortMessage = errors.New("dmtest: short message")
+
+type header [headerSize]byte
+
+func (h *header) i16(off int) int16      { return int16(binary.LittleEndian.Uint16(h[off:])) }
+func (h *header) i32(off int) int32      { return int32(binary.LittleEndian.Uint32(h[off:])) }
+func (h *header) i64(off int) int64      { return int64(binary.LittleEndian.Uint64(h[off:])) }
+func (h *header) put8(off int, v byte)   { h[off] = v }
+func (h *header) put16(off int, v int16) { binary.LittleEndian.PutUint16(h[off:], uint16(v)) }
+func (h *header) put32(off int, v int32) { binary.LittleEndian.PutUint32(h[off:], uint32(v)) }
+func (h *header) put64(off int, v int64) { binary.LittleEndian.PutUint64(h[off:], uint64(v)) }
+
+// seal 填写包体长度和校验字节
+func (h *header) seal(bodyLen int) {
+	h.put32(offBodyLen, int32(bodyLen))
+	var sum byte
+	for _, b := range h[:offChecksum] {
+		sum ^= b
+	}
+	h[offChecksum] = sum
+}
+
+// reader 顺序读取包体, 越界时 panic(errShortMessage), 由会话统一恢复
+type reader struct {
+	b   []byte
+	off int
+}
+
+func (r *reader) next(n int) []byte {
+	if n < 0 || r.off+n > len(r.b) {
+		panic(errShortMessage)
+	}
+	r.off += n
+	return r.b[r.off-n : r.off]
+}
+
+func (r *reader) remain() int { return len(r.b) - r.off }
+func (r *reader) u8() byte    { return r.next(1)[0] }
+func (r *reader) u16() uint16 { return binary.LittleEndian.Uint16(r.next(2)) }
+func (r *reader) i16() int16  { return int16(r.u16()) }
+func (r *reader) i32() int32  { return int32(binary.LittleEndian.Uint32(r.next(4))) }
+func (r *reader) i64() int64  { return int64(binary.LittleEndian.Uint64(r.next(8))) }
+
+// bytes 读取 int32 长度前缀的字节串
+func (r *reader) bytes() []byte { return r.next(int(r.i32())) }
+
+// cstring 读取以 0 结尾的字符串
+func (r *reader) cstring() string {
+	for i := r.off; i < len(r.b); i++ {
+		if r.b[i] == 0 {
+			s := string(r.b[r.off:i])
+			r.off = i + 1
+			return s
+		}
+	}
+	s := string(r.b[r.off:])
+	r.off = len(r.b)
+	return s
+}
+
+type writer struct {
+	b []byte
+}
+
+func (w *writer) u8(v byte)    { w.b = append(w.b, v) }
+func (w *writer) u16(v uint16) { w.b = binary.LittleEndian.AppendUint16(w.b, v) }
+func (w *writer) i16(v int16)  { w.u16(uint16(v)) }
+func (w *writer) i32(v int32)  { w.b = binary.LittleEndian.AppendUint32(w.b, uint32(v)) }
+func (w *writer) i64(v int64)  { w.b = binary.LittleEndian.AppendUint64(w.b, uint64(v)) }
+func (w *writer) raw(b []byte) { w.b = append(w.b, b...) }
+
+// bytes 写 int32 长度前缀的字节串
+func (w *writer) bytes(b []byte) {
+	w.i32(int32(len(b)))
+	w.raw(b)
+}
+
+func (w *writer) string(s string) { w.bytes([]byte(s)) }
+
+// message 写错误/提示信息, 驱动先跳过三段附加信息再读取文本
+func (w *writer) message(s string) {
+	w.i32(0)
+	w.i32(0)
+	w.i32(0)
+	w.string(s)
+}
+
+// encodeValue 把 Go 值编码为列类型对应的存储格式
+func encodeValue(colType int32, v interface{}) ([]byte, error) {
+	w := &writer{}
+	switch colType {
+	case Bit, TinyInt:
+		n, err := toInt64(v)
+		if err != nil {
+			return nil, err
+		}
+		w.u8(byte(n))
+	case SmallInt:
+		n, err := toInt64(v)
+		if err != nil {
+			return nil, err
+		}
+		w.i16(int16(n))
+	case Int:
+		n, err := toInt64(v)
+		if err != nil {
+			return nil, err
+		}
+		w.i32(int32(n))
+	case BigInt:
+		n, err := toInt64(v)
+		if err != nil {
+			return nil, err
+		}
+		w.i64(n)
+	case Real:
+		f, err := toFloat64(v)
+		if err != nil {
+			return nil, err
+		}
+		w.b = binary.LittleEndian.AppendUint32(w.b, math.Float32bits(float32(f)))
+	case Double:
+		f, err := toFloat64(v)
+		if err != nil {
+			return nil, err
+		}
+		w.b = binary.LittleEndian.AppendUint64(w.b, math.Float64bits(f))
+	default:
+		w.raw(toBytes(v))
+	}
+	return w.b, nil
+}
+
+// decodeValue 按绑定参数的类型解码参数值
+func decodeValue(colType int32, b []byte) interface{} {
+	r := &reader{b: b}
+	switch {
+	case colType == typeNull:
+		return nil
+	case (colType == Bit || colType == TinyInt) && len(b) == 1:
+		return int64(int8(r.u8()))
+	case colType == SmallInt && len(b) == 2:
+		return int64(r.i16())
+	case colType == Int && len(b) == 4:
+		return int64(r.i32())
+	case colType == BigInt && len(b) == 8:
+		return r.i64()
+	case colType == Real && len(b) == 4:
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+	case colType == Double && len(b) == 8:
+		return math.Float64frombits(binary.LittleEndian.Uint64(b))
+	case colType == Char || colType == Varchar || colType == Clob:
+		return string(b)
+	}
+	return append([]byte(nil), b...)
+}
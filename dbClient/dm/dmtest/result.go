@@ -0,0 +1,144 @@
+package dmtest
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Column 结果集列
+type Column struct {
+	Name string
+	Type int32 // 列类型, 取 Int/BigInt/Varchar/Blob 等常量
+}
+
+// Result 语句的执行结果. Columns 非空时按查询返回结果集, 否则按 DML 返回影响行数
+type Result struct {
+	Columns []Column
+	// Rows 结果集数据, 整数列可用任意整型, BLOB 取 []byte, CLOB 取 string, nil 表示 NULL
+	Rows     [][]interface{}
+	Affected int64 // 每组参数影响的行数
+	Err      *Error
+
+	// Out 存储过程 OUT/INOUT 参数的返回值, 按参数顺序排列
+	Out []interface{}
+	// Next 存储过程返回的下一个结果集
+	Next *Result
+}
+
+// 参数的输入输出类型
+const (
+	ParamIn = iota
+	ParamOut
+	ParamInOut
+)
+
+// Param 预编译时返回的参数描述
+type Param struct {
+	Type int32 // 参数类型, 取 Int/BigInt/Varchar 等常量
+	IO   int   // ParamIn/ParamOut/ParamInOut
+}
+
+// Error 服务端返回的错误, Code 为达梦错误码(负数)
+type Error struct {
+	Code int32
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("dmtest: [%d] %s", e.Code, e.Msg)
+}
+
+// Errorf 构造错误结果
+func Errorf(code int32, format string, args ...interface{}) *Result {
+	return &Result{Err: &Error{Code: code, Msg: fmt.Sprintf(format, args...)}}
+}
+
+// Query 客户端执行的一条语句
+type Query struct {
+	SQL string
+	// Args 绑定参数, 批量执行时每行一组; 无参数时为空
+	Args [][]interface{}
+}
+
+// normalize 统一语句的大小写和空白, 用于匹配 Handle 注册的语句
+func normalize(sql string) string {
+	sql = strings.TrimSpace(sql)
+	sql = strings.TrimSuffix(sql, ";")
+	return strings.ToLower(strings.Join(strings.Fields(sql), " "))
+}
+
+func isCall(sql string) bool {
+	return strings.HasPrefix(normalize(sql), "call ")
+}
+
+func isQuery(sql string) bool {
+	s := normalize(sql)
+	return strings.HasPrefix(s, "select") || strings.HasPrefix(s, "with")
+}
+
+// countParams 统计语句中引号之外的 ? 个数
+func countParams(sql string) int {
+	n := 0
+	var quote rune
+	for _, c := range sql {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '?':
+			n++
+		}
+	}
+	return n
+}
+
+func toInt64(v interface{}) (int64, error) {
+	switch v := v.(type) {
+	case int:
+		return int64(v), nil
+	case int8:
+		return int64(v), nil
+	case int16:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case uint8:
+		return int64(v), nil
+	case uint16:
+		return int64(v), nil
+	case uint32:
+		return int64(v), nil
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	return 0, fmt.Errorf("dmtest: %T is not an integer", v)
+}
+
+func toFloat64(v interface{}) (float64, error) {
+	switch v := v.(type) {
+	case float32:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	}
+	n, err := toInt64(v)
+	return float64(n), err
+}
+
+func toBytes(v interface{}) []byte {
+	switch v := v.(type) {
+	case []byte:
+		return v
+	case string:
+		return []byte(v)
+	}
+	return []byte(fmt.Sprint(v))
+}
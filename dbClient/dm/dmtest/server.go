@@ -0,0 +1,285 @@
+// Package dmtest 提供进程内的达梦协议模拟服务, 用于离线测试 dm 驱动和 dbClient.
+//
+// 只实现驱动常用的子集: 登录及加密协商、直接执行、预编译和批量绑定、结果集、大字段读写、错误返回.
+// 语句结果通过 Handle/HandleFunc 预先注册, 用法类似 net/http/httptest:
+//
+//	srv, _ := dmtest.NewServer()
+//	defer srv.Close()
+//	srv.Handle("select id, name from t", &dmtest.Result{...})
+//	db, _ := sql.Open("dm", srv.DSN())
+package dmtest
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"unicode/utf8"
+)
+
+// EncryptMode 服务端要求的加密方式
+type EncryptMode int
+
+const (
+	EncryptNone  EncryptMode = iota // 不加密
+	EncryptLogin                    // 只加密登录的用户名密码
+	EncryptAll                      // 登录后所有消息体加密
+)
+
+const (
+	defaultUser     = "SYSDBA"
+	defaultPassword = "SYSDBA"
+	serverVersion   = "8.1.2.128"
+)
+
+// CodeAuthFailed 用户名或密码错误
+const CodeAuthFailed int32 = -2501
+
+// Server 模拟服务
+type Server struct {
+	ln net.Listener
+	wg sync.WaitGroup
+
+	mu       sync.Mutex
+	user     string
+	password string
+	encrypt  EncryptMode
+	handlers map[string]*Result
+	params   map[string][]Param
+	fallback func(q *Query) *Result
+	queries  []*Query
+	lobs     map[int64]*lobData
+	lobSeq   int64
+	sessSeq  int64
+	conns    map[net.Conn]struct{}
+	closed   bool
+}
+
+type lobData struct {
+	char bool // CLOB 按字符计长度和位置
+	data []byte
+}
+
+func (l *lobData) length() int64 {
+	if l.char {
+		return int64(utf8.RuneCount(l.data))
+	}
+	return int64(len(l.data))
+}
+
+// NewServer 在 127.0.0.1 的随机端口上启动服务, 默认用户名密码 SYSDBA/SYSDBA
+func NewServer() (*Server, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		ln:       ln,
+		user:     defaultUser,
+		password: defaultPassword,
+		handlers: make(map[string]*Result),
+		params:   make(map[string][]Param),
+		lobs:     make(map[int64]*lobData),
+		conns:    make(map[net.Conn]struct{}),
+	}
+	s.Handle("select 1", &Result{Columns: []Column{{Name: "1", Type: Int}}, Rows: [][]interface{}{{1}}})
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Addr 监听地址
+func (s *Server) Addr() string {
+	return s.ln.Addr().String()
+}
+
+// DSN 连接串, 可直接用于 sql.Open("dm", ...), 额外参数以 key=value 形式追加
+func (s *Server) DSN(params ...string) string {
+	s.mu.Lock()
+	dsn := fmt.Sprintf("dm://%s:%s@%s", s.user, s.password, s.Addr())
+	s.mu.Unlock()
+	for i, p := range params {
+		if i == 0 {
+			dsn += "?" + p
+		} else {
+			dsn += "&" + p
+		}
+	}
+	return dsn
+}
+
+// SetAuth 设置允许登录的用户名和密码
+func (s *Server) SetAuth(user, password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.user, s.password = user, password
+}
+
+// SetEncrypt 设置新连接的加密方式, 客户端关闭 loginEncrypt 时不加密
+func (s *Server) SetEncrypt(mode EncryptMode) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.encrypt = mode
+}
+
+// Handle 注册语句的结果, 匹配时忽略大小写、多余空白和结尾的分号
+func (s *Server) Handle(sql string, r *Result) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[normalize(sql)] = r
+}
+
+// HandleFunc 注册未被 Handle 匹配的语句的处理函数, 返回 nil 时按默认规则处理:
+// 查询返回错误, 其他语句每组参数影响 1 行
+func (s *Server) HandleFunc(f func(q *Query) *Result) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fallback = f
+}
+
+// SetParamTypes 指定语句预编译时返回的参数类型, 未指定时参数类型由驱动按绑定值推断
+func (s *Server) SetParamTypes(sql string, types ...int32) {
+	params := make([]Param, len(types))
+	for i, t := range types {
+		params[i] = Param{Type: t}
+	}
+	s.SetParams(sql, params...)
+}
+
+// SetParams 指定语句预编译时返回的参数描述, 用于存储过程的 OUT/INOUT 参数
+func (s *Server) SetParams(sql string, params ...Param) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.params[normalize(sql)] = params
+}
+
+// Queries 返回已执行的语句, 事务提交和回滚记为 COMMIT/ROLLBACK
+func (s *Server) Queries() []*Query {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*Query(nil), s.queries...)
+}
+
+// Lob 返回服务端保存的大字段内容, 客户端通过 DmBlob/DmClob 写入后可据此检查
+func (s *Server) Lob(id int64) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.lobs[id]
+	if !ok {
+		return nil, false
+	}
+	return append([]byte(nil), l.data...), true
+}
+
+// DropConns 断开当前所有连接, 模拟网络中断
+func (s *Server) DropConns() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.conns {
+		c.Close()
+	}
+}
+
+// Close 停止监听并断开所有连接
+func (s *Server) Close() {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	s.ln.Close()
+	s.DropConns()
+	s.wg.Wait()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		c, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			c.Close()
+			return
+		}
+		s.conns[c] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			newSession(s, c).run()
+			s.mu.Lock()
+			delete(s.conns, c)
+			s.mu.Unlock()
+			c.Close()
+		}()
+	}
+}
+
+// exec 匹配注册的结果, 记录执行的语句
+func (s *Server) exec(q *Query) *Result {
+	s.mu.Lock()
+	s.queries = append(s.queries, q)
+	r, ok := s.handlers[normalize(q.SQL)]
+	f := s.fallback
+	s.mu.Unlock()
+
+	if !ok && f != nil {
+		r = f(q)
+	}
+	if r == nil {
+		if isQuery(q.SQL) {
+			return Errorf(-2106, "no result registered for %q", q.SQL)
+		}
+		r = &Result{Affected: 1}
+	}
+	return r
+}
+
+func (s *Server) record(sql string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queries = append(s.queries, &Query{SQL: sql})
+}
+
+func (s *Server) paramTypes(sql string) ([]Param, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.params[normalize(sql)]
+	return t, ok
+}
+
+func (s *Server) sessionID() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessSeq++
+	return s.sessSeq
+}
+
+func (s *Server) auth() (string, string, EncryptMode) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.user, s.password, s.encrypt
+}
+
+// putLob 保存大字段, 返回 blobId
+func (s *Server) putLob(char bool, data []byte) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lobSeq++
+	s.lobs[s.lobSeq] = &lobData{char: char, data: append([]byte(nil), data...)}
+	return s.lobSeq
+}
+
+// withLob 在锁内访问大字段, 不存在时按空值创建
+func (s *Server) withLob(id int64, char bool, f func(l *lobData)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.lobs[id]
+	if !ok {
+		l = &lobData{char: char}
+		s.lobs[id] = l
+	}
+	f(l)
+}
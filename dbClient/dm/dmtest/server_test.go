@@ -0,0 +1,167 @@
+package dmtest_test
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/jifuy/commongo/dbClient/dm"
+	"github.com/jifuy/commongo/dbClient/dm/dmtest"
+)
+
+func open(t *testing.T, srv *dmtest.Server, params ...string) *sql.DB {
+	db, err := sql.Open("dm", srv.DSN(params...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestLoginEncrypt(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		mode   dmtest.EncryptMode
+		params []string
+	}{
+		{"none", dmtest.EncryptNone, nil},
+		{"plain", dmtest.EncryptAll, []string{"loginEncrypt=false"}},
+		{"login", dmtest.EncryptLogin, nil},
+		{"all", dmtest.EncryptAll, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv, err := dmtest.NewServer()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer srv.Close()
+			srv.SetEncrypt(tc.mode)
+			srv.Handle("select id, name from t", &dmtest.Result{
+				Columns: []dmtest.Column{{Name: "ID", Type: dmtest.BigInt}, {Name: "NAME", Type: dmtest.Varchar}},
+				Rows:    [][]interface{}{{1, "a"}, {2, nil}},
+			})
+
+			db := open(t, srv, tc.params...)
+			if err = db.Ping(); err != nil {
+				t.Fatal(err)
+			}
+			rows, err := db.Query("SELECT id, name FROM t")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rows.Close()
+			var got []string
+			for rows.Next() {
+				var id int64
+				var name sql.NullString
+				if err = rows.Scan(&id, &name); err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, name.String)
+			}
+			if err = rows.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 2 || got[0] != "a" || got[1] != "" {
+				t.Fatalf("rows = %q", got)
+			}
+		})
+	}
+}
+
+func TestExecArgs(t *testing.T) {
+	srv, err := dmtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	srv.HandleFunc(func(q *dmtest.Query) *dmtest.Result {
+		if len(q.Args) > 0 && q.Args[0][0] == int64(2) {
+			return dmtest.Errorf(-6602, "violate unique constraint")
+		}
+		return nil
+	})
+
+	db := open(t, srv)
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := tx.Exec("insert into t(id, name, score) values(?, ?, ?)", 1, "张三", 1.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		t.Fatalf("RowsAffected = %d", n)
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec("insert into t(id, name, score) values(?, ?, ?)", 2, "李四", nil)
+	if !errors.Is(err, dm.ErrUniqueViolation) {
+		t.Fatalf("err = %v, want ErrUniqueViolation", err)
+	}
+
+	var args []interface{}
+	var commit bool
+	for _, q := range srv.Queries() {
+		if q.SQL == "COMMIT" {
+			commit = true
+		}
+		if len(q.Args) > 0 && args == nil {
+			args = q.Args[0]
+		}
+	}
+	if !commit {
+		t.Error("commit not recorded")
+	}
+	if len(args) != 3 || args[0] != int64(1) || args[1] != "张三" || args[2] != 1.5 {
+		t.Fatalf("args = %#v", args)
+	}
+}
+
+func TestAuthFailed(t *testing.T) {
+	srv, err := dmtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	db := open(t, srv)
+	srv.SetAuth("SYSDBA", "other")
+	if err = db.Ping(); !errors.Is(err, dm.ErrAuthFailed) {
+		t.Fatalf("err = %v, want ErrAuthFailed", err)
+	}
+}
+
+func TestBlob(t *testing.T) {
+	srv, err := dmtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	data := make([]byte, 100000)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	srv.Handle("select content from doc", &dmtest.Result{
+		Columns: []dmtest.Column{{Name: "CONTENT", Type: dmtest.Blob}},
+		Rows:    [][]interface{}{{data}},
+	})
+
+	db := open(t, srv)
+	var blob dm.DmBlob
+	if err = db.QueryRow("select content from doc").Scan(&blob); err != nil {
+		t.Fatal(err)
+	}
+	n, err := blob.GetLength()
+	if err != nil || n != int64(len(data)) {
+		t.Fatalf("GetLength = %d, %v", n, err)
+	}
+	got := make([]byte, n)
+	if _, err = blob.ReadAt(1, got); err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(data) {
+		t.Fatalf("blob mismatch, got %d bytes", len(got))
+	}
+}
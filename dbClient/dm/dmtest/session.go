@@ -0,0 +1,669 @@
+package dmtest
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jifuy/commongo/dbClient/dm/security"
+)
+
+// replyRows 执行和 fetch 每次返回的最大行数, 超出部分由驱动继续 fetch
+const replyRows = 1000
+
+type session struct {
+	srv  *Server
+	conn net.Conn
+
+	login  *security.SymmCipher // 只加密登录信息
+	cipher *security.SymmCipher // 加密全部消息体
+
+	stmts   map[int32]*stmt
+	stmtSeq int32
+}
+
+type stmt struct {
+	sql     string
+	params  []Param
+	putData map[int][]byte
+	cols    []Column
+	rows    [][]byte // 已编码的结果集行, 供 fetch 使用
+	next    *Result  // 存储过程待返回的结果集
+}
+
+type response struct {
+	h header
+	writer
+}
+
+func newSession(srv *Server, conn net.Conn) *session {
+	return &session{srv: srv, conn: conn, stmts: make(map[int32]*stmt)}
+}
+
+func errorResponse(code int32, msg string) *response {
+	resp := &response{}
+	resp.h.put32(offRetCode, code)
+	resp.message(msg)
+	return resp
+}
+
+func (ss *session) run() {
+	for {
+		var h header
+		if _, err := io.ReadFull(ss.conn, h[:]); err != nil {
+			return
+		}
+		body := make([]byte, h.i32(offBodyLen))
+		if _, err := io.ReadFull(ss.conn, body); err != nil {
+			return
+		}
+		cmd := h.i16(offCmd)
+		if ss.cipher != nil && cmd != cmdStartup && len(body) > 0 {
+			var err error
+			if body, err = ss.cipher.Decrypt(body, true); err != nil {
+				return
+			}
+		}
+		resp, err := ss.handle(cmd, &h, &reader{b: body})
+		if err != nil {
+			return
+		}
+		if err = ss.write(cmd, resp); err != nil {
+			return
+		}
+	}
+}
+
+func (ss *session) write(cmd int16, resp *response) error {
+	body := resp.b
+	if ss.cipher != nil && cmd != cmdStartup && len(body) > 0 {
+		body = ss.cipher.Encrypt(body, true)
+	}
+	resp.h.put16(offCmd, cmd)
+	resp.h.seal(len(body))
+	if _, err := ss.conn.Write(resp.h[:]); err != nil {
+		return err
+	}
+	_, err := ss.conn.Write(body)
+	return err
+}
+
+func (ss *session) handle(cmd int16, h *header, r *reader) (resp *response, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			if p != errShortMessage {
+				panic(p)
+			}
+			err = fmt.Errorf("dmtest: malformed message, cmd %d", cmd)
+		}
+	}()
+
+	switch cmd {
+	case cmdStartup:
+		return ss.startup(h, r)
+	case cmdLogin:
+		return ss.doLogin(r), nil
+	case cmdAllocStmt:
+		ss.stmtSeq++
+		ss.stmts[ss.stmtSeq] = &stmt{}
+		resp = &response{}
+		resp.h.put32(offStmtID, ss.stmtSeq)
+		return resp, nil
+	case cmdFreeStmt:
+		delete(ss.stmts, h.i32(offStmtID))
+	case cmdPrepare:
+		return ss.prepare(ss.stmt(h), h, r), nil
+	case cmdExecute, cmdExecute2:
+		return ss.execute(ss.stmt(h), h, r)
+	case cmdFetch:
+		return ss.fetch(ss.stmt(h), h), nil
+	case cmdPutData:
+		st := ss.stmt(h)
+		if st.putData == nil {
+			st.putData = make(map[int][]byte)
+		}
+		i := int(h.i16(offCmdData))
+		st.putData[i] = append(st.putData[i], r.next(int(r.i32()))...)
+	case cmdCommit:
+		ss.srv.record("COMMIT")
+	case cmdRollback:
+		ss.srv.record("ROLLBACK")
+	case cmdMoreResult:
+		return ss.moreResult(ss.stmt(h)), nil
+	case cmdLobLength:
+		return ss.lobLength(r), nil
+	case cmdLobRead:
+		return ss.lobRead(r), nil
+	case cmdLobWrite:
+		return ss.lobWrite(r), nil
+	case cmdLobTrunc:
+		return ss.lobTruncate(r), nil
+	}
+	// 其余命令(包括 preExec、隔离级别等)返回空的成功应答
+	return &response{}, nil
+}
+
+func (ss *session) stmt(h *header) *stmt {
+	id := h.i32(offStmtID)
+	st, ok := ss.stmts[id]
+	if !ok {
+		st = &stmt{}
+		ss.stmts[id] = st
+	}
+	return st
+}
+
+// startup 协商编码和加密, 客户端开启 loginEncrypt 时请求体带 DH 公钥
+func (ss *session) startup(h *header, r *reader) (*response, error) {
+	r.bytes()
+	r.u8()
+	var clientKey []byte
+	if h[28] == 1 && r.remain() > 0 {
+		clientKey = r.bytes()
+	}
+
+	resp := &response{}
+	resp.h.put32(28, 1) // UTF-8
+	resp.h.put16(48, h.i16(35))
+	resp.message("")
+	resp.string(serverVersion)
+
+	_, _, mode := ss.srv.auth()
+	if mode == EncryptNone || clientKey == nil {
+		return resp, nil
+	}
+	key, err := security.NewClientKeyPair()
+	if err != nil {
+		return nil, err
+	}
+	c, err := security.NewSymmCipher(security.DES_CFB, security.ComputeSessionKey(key, clientKey))
+	if err != nil {
+		return nil, err
+	}
+	resp.h.put8(40, 1)
+	if mode == EncryptAll {
+		resp.h.put8(41, 1)
+		resp.i32(int32(security.DES_CFB))
+		ss.cipher = &c
+	} else {
+		ss.login = &c
+	}
+	resp.bytes(security.Bn2Bytes(key.GetY(), security.DH_KEY_LENGTH))
+	return resp, nil
+}
+
+func (ss *session) doLogin(r *reader) *response {
+	user, password := r.bytes(), r.bytes()
+	if ss.login != nil {
+		user, _ = ss.login.Decrypt(user, false)
+		password, _ = ss.login.Decrypt(password, false)
+	}
+	wantUser, wantPassword, _ := ss.srv.auth()
+	if !strings.EqualFold(string(user), wantUser) || string(password) != wantPassword {
+		return errorResponse(CodeAuthFailed, "invalid username or password")
+	}
+
+	resp := &response{}
+	resp.h.put32(29, 1)   // 隔离级别: 读提交
+	resp.h.put8(33, 1)    // 大小写敏感
+	resp.h.put16(37, 4)   // 服务器状态: OPEN
+	resp.h.put16(40, 480) // 时区
+	resp.message("")
+	resp.string("DMSERVER")
+	resp.string(strings.ToUpper(wantUser))
+	resp.string("")
+	resp.string("")
+	resp.i32(0)
+	resp.i32(0)
+	resp.i32(0)
+	resp.string("")
+	resp.string("DAMENG")
+	resp.i64(ss.srv.sessionID())
+	return resp
+}
+
+func (ss *session) prepare(st *stmt, h *header, r *reader) *response {
+	sql := r.cstring()
+	st.sql, st.putData = sql, nil
+	if h[21] == 1 {
+		return ss.direct(st)
+	}
+
+	params, exact := ss.srv.paramTypes(sql)
+	if !exact {
+		params = make([]Param, countParams(sql))
+		for i := range params {
+			params[i].Type = Varchar
+		}
+	}
+	st.params = params
+
+	resp := &response{}
+	resp.h.put16(20, retSqlType(sql))
+	resp.h.put16(22, int16(len(params)))
+	for i, p := range params {
+		t := p.Type
+		var flag int16
+		if !exact {
+			flag |= itemFlagRecommend
+		}
+		if isLob(t) {
+			flag |= itemFlagLob
+		}
+		resp.i32(t)
+		resp.i32(precOf(t))
+		resp.i32(0)
+		resp.i32(1)
+		resp.i16(flag)
+		resp.i32(0)
+		resp.i16(int16(p.IO))
+		resp.i16(0)
+		resp.i16(0)
+		resp.i16(0)
+		resp.i16(0)
+		if isLob(t) {
+			resp.i32(1)
+			resp.i16(int16(i))
+		}
+	}
+	return resp
+}
+
+// direct 直接执行不带参数的语句
+func (ss *session) direct(st *stmt) *response {
+	sql := normalize(st.sql)
+	if strings.HasPrefix(sql, "set schema ") {
+		ss.srv.record(st.sql)
+		resp := &response{}
+		resp.h.put16(20, sqlTypeSchema)
+		resp.string(strings.ToUpper(strings.TrimSpace(st.sql[strings.Index(strings.ToLower(st.sql), "schema")+6:])))
+		return resp
+	}
+	q := &Query{SQL: st.sql}
+	return ss.reply(st, 1, ss.srv.exec(q))
+}
+
+func (ss *session) execute(st *stmt, h *header, r *reader) (*response, error) {
+	nparam := int(uint16(h.i16(21)))
+	nrow := int(h.i64(24))
+
+	types := make([]int32, nparam)
+	ioTypes := make([]byte, nparam)
+	for i := range types {
+		ioTypes[i] = r.u8()
+		types[i] = r.i32()
+		r.i32()
+		r.i32()
+	}
+
+	q := &Query{SQL: st.sql}
+	for row := 0; row < nrow; row++ {
+		args := make([]interface{}, nparam)
+		for i := range args {
+			if ioTypes[i] == ParamOut {
+				continue
+			}
+			n := r.u16()
+			switch {
+			case n == dataNull:
+			case n == dataLobCtl:
+				head := &reader{b: r.next(lobHeadSize)}
+				head.u8()
+				id := head.i64()
+				ss.srv.withLob(id, types[i] == Clob, func(l *lobData) {
+					args[i] = decodeValue(types[i], l.data)
+				})
+			case n == 0 && st.putData[i] != nil:
+				args[i] = decodeValue(types[i], st.putData[i])
+				delete(st.putData, i)
+			default:
+				args[i] = decodeValue(types[i], r.next(int(n)))
+			}
+		}
+		q.Args = append(q.Args, args)
+	}
+	return ss.reply(st, nrow, ss.srv.exec(q)), nil
+}
+
+// reply 组装执行应答, nrow 为执行的参数组数, 为 0 时是存储过程后续的结果集, 不带 OUT 参数
+func (ss *session) reply(st *stmt, nrow int, res *Result) *response {
+	if res.Err != nil {
+		return errorResponse(res.Err.Code, res.Err.Msg)
+	}
+
+	resp := &response{}
+	proc := isCall(st.sql)
+	st.next = nil
+	if proc {
+		st.next = res.Next
+		resp.h.put16(20, sqlTypeProc)
+		if nrow > 0 {
+			if err := putOut(resp, st, res.Out); err != nil {
+				return errorResponse(-2106, err.Error())
+			}
+		}
+		if len(res.Columns) == 0 {
+			return resp
+		}
+	} else if len(res.Columns) == 0 {
+		if nrow < 1 {
+			nrow = 1
+		}
+		resp.h.put16(20, sqlTypeInsert)
+		resp.h.put64(24, res.Affected*int64(nrow))
+		resp.h.put8(59, 0x01)
+		resp.i32(int32(nrow))
+		for i := 0; i < nrow; i++ {
+			resp.i64(res.Affected)
+		}
+		return resp
+	}
+
+	st.cols, st.rows = res.Columns, nil
+	for i, row := range res.Rows {
+		b, err := ss.encodeRow(int64(i+1), res.Columns, row)
+		if err != nil {
+			return errorResponse(-2106, err.Error())
+		}
+		st.rows = append(st.rows, b)
+	}
+
+	n := len(st.rows)
+	if n > replyRows {
+		n = replyRows
+	}
+	if !proc {
+		resp.h.put16(20, sqlTypeSelect)
+	}
+	resp.h.put16(22, int16(len(res.Columns)))
+	resp.h.put64(24, int64(len(st.rows)))
+	resp.h.put32(35, int32(n))
+	resp.h.put16(44, -1)
+	for i, c := range res.Columns {
+		var flag int16
+		if isLob(c.Type) {
+			flag = itemFlagLob
+		}
+		resp.i32(c.Type)
+		resp.i32(precOf(c.Type))
+		resp.i32(0)
+		resp.i32(1)
+		resp.i16(flag)
+		resp.i32(0)
+		resp.i16(0)
+		resp.i16(int16(len(c.Name)))
+		resp.i16(0)
+		resp.i16(0)
+		resp.i16(0)
+		resp.raw([]byte(c.Name))
+		if isLob(c.Type) {
+			resp.i32(1)
+			resp.i16(int16(i))
+		}
+	}
+	for _, b := range st.rows[:n] {
+		resp.raw(b)
+	}
+	return resp
+}
+
+// putOut 写入存储过程 OUT/INOUT 参数的返回值, out 为空时全部返回 NULL
+func putOut(resp *response, st *stmt, out []interface{}) error {
+	var types []int32
+	for _, p := range st.params {
+		if p.IO != ParamIn {
+			types = append(types, p.Type)
+		}
+	}
+	if out != nil && len(out) != len(types) {
+		return fmt.Errorf("%d out values, statement has %d out params", len(out), len(types))
+	}
+	resp.h.put16(32, int16(len(types)))
+	for i, t := range types {
+		if out == nil || out[i] == nil {
+			resp.u16(dataNull)
+			continue
+		}
+		b, err := encodeValue(t, out[i])
+		if err != nil {
+			return err
+		}
+		if len(b) >= int(dataNull) {
+			resp.u16(dataLong)
+			resp.bytes(b)
+		} else {
+			resp.u16(uint16(len(b)))
+			resp.raw(b)
+		}
+	}
+	return nil
+}
+
+// moreResult 返回存储过程的下一个结果集, 没有时返回空应答
+func (ss *session) moreResult(st *stmt) *response {
+	if st.next == nil {
+		return &response{}
+	}
+	return ss.reply(st, 0, st.next)
+}
+
+func (ss *session) fetch(st *stmt, h *header) *response {
+	start := h.i64(20)
+	resp := &response{}
+	resp.h.put64(20, int64(len(st.rows)))
+	if start < 0 || start >= int64(len(st.rows)) {
+		return resp
+	}
+	rows := st.rows[start:]
+	if len(rows) > replyRows {
+		rows = rows[:replyRows]
+	}
+	resp.h.put32(28, int32(len(rows)))
+	for _, b := range rows {
+		resp.raw(b)
+	}
+	return resp
+}
+
+func (ss *session) encodeRow(rowid int64, cols []Column, row []interface{}) ([]byte, error) {
+	if len(row) != len(cols) {
+		return nil, fmt.Errorf("row has %d values, want %d", len(row), len(cols))
+	}
+	w := &writer{}
+	w.i16(0)
+	w.i64(rowid)
+	for range cols {
+		w.i16(0)
+	}
+	for i, v := range row {
+		if v == nil {
+			w.u16(dataNull)
+			continue
+		}
+		var b []byte
+		if isLob(cols[i].Type) {
+			b = ss.lobHead(cols[i].Type == Clob, toBytes(v))
+		} else {
+			var err error
+			if b, err = encodeValue(cols[i].Type, v); err != nil {
+				return nil, err
+			}
+		}
+		if len(b) >= int(dataNull) {
+			w.u16(dataLong)
+			w.bytes(b)
+		} else {
+			w.u16(uint16(len(b)))
+			w.raw(b)
+		}
+	}
+	return w.b, nil
+}
+
+// lobHead 保存大字段并返回行外存储的字段头
+func (ss *session) lobHead(char bool, data []byte) []byte {
+	id := ss.srv.putLob(char, data)
+	l := &lobData{char: char, data: data}
+	w := &writer{}
+	w.u8(lobOffRow)
+	w.i64(id)
+	w.i32(int32(l.length()))
+	w.i16(0)
+	w.i16(0)
+	w.i32(0)
+	return w.b
+}
+
+func (ss *session) lobLength(r *reader) *response {
+	char := r.u8() == 1
+	id := r.i64()
+	resp := &response{}
+	ss.srv.withLob(id, char, func(l *lobData) {
+		resp.i64(l.length())
+	})
+	return resp
+}
+
+func (ss *session) lobRead(r *reader) *response {
+	char := r.u8() == 1
+	r.i32()
+	r.i16()
+	id := r.i64()
+	r.next(2 + 2 + 4 + 2 + 4 + 4)
+	start, length := int(r.i32()), int(r.i32())
+
+	resp := &response{}
+	ss.srv.withLob(id, char, func(l *lobData) {
+		from, to, over := l.span(start, length)
+		if over {
+			resp.u8(1)
+		} else {
+			resp.u8(0)
+		}
+		resp.i32(int32(to - from))
+		if to > from {
+			resp.i16(0)
+			resp.i32(0)
+			resp.i32(0)
+			resp.raw(l.data[from:to])
+		}
+	})
+	return resp
+}
+
+func (ss *session) lobWrite(r *reader) *response {
+	char := r.u8() == 1
+	r.u8()
+	id := r.i64()
+	r.next(2 + 2 + 4 + 2 + 4 + 4 + 4 + 2 + 8)
+	pos, n := int(r.i32()), int(r.i32())
+	if n > r.remain() {
+		n = r.remain()
+	}
+	data := r.next(n)
+
+	written := 0
+	ss.srv.withLob(id, char, func(l *lobData) {
+		written = len(data)
+		if char {
+			written = utf8.RuneCount(data)
+		}
+		from, to, _ := l.span(pos, written)
+		buf := append([]byte(nil), l.data[:from]...)
+		buf = append(buf, data...)
+		l.data = append(buf, l.data[to:]...)
+	})
+
+	resp := &response{}
+	resp.i32(int32(written))
+	resp.i64(id)
+	resp.i16(0)
+	resp.i32(0)
+	resp.i16(0)
+	resp.i32(0)
+	resp.i32(0)
+	return resp
+}
+
+func (ss *session) lobTruncate(r *reader) *response {
+	char := r.u8() == 1
+	id := r.i64()
+	r.next(2 + 2 + 4 + 4 + 2 + 8)
+	n := int(r.i32())
+
+	resp := &response{}
+	ss.srv.withLob(id, char, func(l *lobData) {
+		_, to, _ := l.span(0, n)
+		l.data = l.data[:to]
+		resp.i32(int32(l.length()))
+	})
+	resp.i64(id)
+	return resp
+}
+
+// span 把以字节(CLOB 以字符)计的 [start, start+n) 换算成字节区间, 越界部分截断
+func (l *lobData) span(start, n int) (from, to int, over bool) {
+	if !l.char {
+		from, to = clamp(start, len(l.data)), clamp(start+n, len(l.data))
+		return from, to, to == len(l.data)
+	}
+	from, to = len(l.data), len(l.data)
+	i := 0
+	for off := range string(l.data) {
+		if i == start {
+			from = off
+		}
+		if i == start+n {
+			to = off
+			break
+		}
+		i++
+	}
+	return from, to, to == len(l.data)
+}
+
+func clamp(n, max int) int {
+	if n < 0 {
+		return 0
+	}
+	if n > max {
+		return max
+	}
+	return n
+}
+
+func isLob(t int32) bool {
+	return t == Blob || t == Clob
+}
+
+func precOf(t int32) int32 {
+	switch t {
+	case Bit, TinyInt:
+		return 3
+	case SmallInt:
+		return 5
+	case Int:
+		return 10
+	case BigInt:
+		return 19
+	case Real:
+		return 24
+	case Double:
+		return 53
+	case Blob, Clob:
+		return 0x7FFFFFFF
+	}
+	return 8188
+}
+
+func retSqlType(sql string) int16 {
+	if isCall(sql) {
+		return sqlTypeProc
+	}
+	if isQuery(sql) {
+		return sqlTypeSelect
+	}
+	return sqlTypeInsert
+}
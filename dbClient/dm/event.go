@@ -0,0 +1,138 @@
+package dm
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EventType 连接事件类型
+type EventType int
+
+const (
+	EventReconnect        EventType = iota + 1 // 通信异常或节点恢复, 开始重连
+	EventReconnectSuccess                      // 重连成功
+	EventReconnectFailed                       // 重连失败
+	EventPrimarySwitch                         // 重连后切换到了另一个节点
+	EventStandbyLost                           // 读写分离的备机连接异常, 已移除
+	EventStandbyRecovered                      // 读写分离的备机重新连上
+	EventRoute                                 // 读写分离为语句选择了主机或备机
+)
+
+var eventTypeNames = map[EventType]string{
+	EventReconnect:        "reconnect",
+	EventReconnectSuccess: "reconnect_success",
+	EventReconnectFailed:  "reconnect_failed",
+	EventPrimarySwitch:    "primary_switch",
+	EventStandbyLost:      "standby_lost",
+	EventStandbyRecovered: "standby_recovered",
+	EventRoute:            "route",
+}
+
+func (t EventType) String() string {
+	if name, ok := eventTypeNames[t]; ok {
+		return name
+	}
+	return "event(" + strconv.Itoa(int(t)) + ")"
+}
+
+func (s RWSiteEnum) String() string {
+	switch s {
+	case PRIMARY:
+		return "primary"
+	case STANDBY:
+		return "standby"
+	}
+	return "any"
+}
+
+// Event 连接事件
+type Event struct {
+	Type   EventType
+	Time   time.Time
+	Addr   string     // 事件发生后连接的节点 host:port, 备机事件为备机地址
+	From   string     // EventPrimarySwitch 切换前的节点
+	Site   RWSiteEnum // EventRoute 选择的站点
+	SQL    string     // EventRoute 路由的语句
+	Reason string     // 重连原因
+	Err    error      // 重连失败或备机异常的错误
+}
+
+type eventHandler struct {
+	id int64
+	f  func(Event)
+}
+
+var (
+	eventMu       sync.RWMutex
+	eventHandlers []eventHandler
+	eventSeq      int64
+	eventCount    int32 // 无订阅时跳过事件构造, 路由事件每条语句都会触发
+)
+
+// Subscribe 订阅连接事件, 返回取消订阅的函数.
+// 回调在触发事件的连接上同步执行, 不能阻塞, 也不能在回调中使用同一连接
+func Subscribe(f func(Event)) (cancel func()) {
+	eventMu.Lock()
+	defer eventMu.Unlock()
+	eventSeq++
+	id := eventSeq
+	eventHandlers = append(eventHandlers, eventHandler{id: id, f: f})
+	atomic.AddInt32(&eventCount, 1)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			eventMu.Lock()
+			defer eventMu.Unlock()
+			for i, h := range eventHandlers {
+				if h.id == id {
+					eventHandlers = append(eventHandlers[:i:i], eventHandlers[i+1:]...)
+					atomic.AddInt32(&eventCount, -1)
+					return
+				}
+			}
+		})
+	}
+}
+
+func hasEventHandler() bool {
+	return atomic.LoadInt32(&eventCount) > 0
+}
+
+func emitEvent(e Event) {
+	if !hasEventHandler() {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	eventMu.RLock()
+	handlers := eventHandlers
+	eventMu.RUnlock()
+	for _, h := range handlers {
+		h.f(e)
+	}
+}
+
+// addr 本连接建立时的地址, 不读取共享的连接器
+func (dc *DmConnection) addr() string {
+	return dc.endpoint
+}
+
+// reconnectWithEvent 执行重连并发出重连和切换事件
+func (dc *DmConnection) reconnectWithEvent(reason string, reconnect func() error) error {
+	from := dc.addr()
+	emitEvent(Event{Type: EventReconnect, Addr: from, Reason: reason})
+	if err := reconnect(); err != nil {
+		emitEvent(Event{Type: EventReconnectFailed, Addr: from, Reason: reason, Err: err})
+		return err
+	}
+	to := dc.addr()
+	emitEvent(Event{Type: EventReconnectSuccess, Addr: to, Reason: reason})
+	if to != from {
+		emitEvent(Event{Type: EventPrimarySwitch, Addr: to, From: from, Reason: reason})
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package dm
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/jifuy/commongo/dbClient/dm/dmtest"
+)
+
+func TestReconnectEvents(t *testing.T) {
+	srv, err := dmtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	var mu sync.Mutex
+	var got []EventType
+	cancel := Subscribe(func(e Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, e.Type)
+		if e.Addr != srv.Addr() {
+			t.Errorf("%s addr = %s", e.Type, e.Addr)
+		}
+	})
+	defer cancel()
+
+	db, err := sql.Open("dm", srv.DSN("doSwitch=1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if err = db.Ping(); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.DropConns()
+	if _, err = db.Exec("update t set a = 1"); err == nil {
+		t.Fatal("expected switched error")
+	}
+	if _, err = db.Exec("update t set a = 1"); err != nil {
+		t.Fatalf("after reconnect: %v", err)
+	}
+	srv.Close()
+	db.Exec("update t set a = 1")
+
+	// 取消后不再收到事件
+	cancel()
+	emitEvent(Event{Type: EventReconnect, Addr: srv.Addr()})
+	mu.Lock()
+	defer mu.Unlock()
+	want := []EventType{EventReconnect, EventReconnectSuccess, EventReconnect, EventReconnectFailed}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("events = %v, want %v", got, want)
+	}
+}
+
+func TestEventAddrPerConnection(t *testing.T) {
+	srv, err := dmtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	db, err := sql.Open("dm", srv.DSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	err = conn.Raw(func(driverConn interface{}) error {
+		dc := driverConn.(*DmConnection)
+		// 同一连接器的其他连接切换到别的节点后, 本连接仍报告自己的地址
+		dc.dmConnector.host, dc.dmConnector.port = "10.0.0.2", 5237
+		if got := dc.addr(); got != srv.Addr() {
+			t.Errorf("addr = %s, want %s", got, srv.Addr())
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
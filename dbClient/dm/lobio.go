@@ -0,0 +1,200 @@
+package dm
+
+import (
+	"errors"
+	"io"
+	"unicode/utf8"
+)
+
+const (
+	blobReadChunk = Dm_build_388     // BLOB 每次读取的字节数
+	clobReadChunk = Dm_build_388 / 2 // CLOB 每次读取的字符数
+	lobWriteChunk = Dm_build_387     // 每次写入的字节数
+)
+
+var errClobPartial = errors.New("dm: clob writer closed with incomplete utf-8 sequence")
+
+// lobReader 按块顺序读取大字段, 只缓存当前块
+type lobReader struct {
+	read func(pos int64, n int32) ([]byte, int64, error) // 返回数据和读取的长度(CLOB 为字符数)
+	pos  int64
+	left int64 // 剩余长度, -1 表示读到末尾
+	size int32
+	buf  []byte
+}
+
+func (r *lobReader) Read(p []byte) (int, error) {
+	if len(r.buf) == 0 {
+		if r.left == 0 {
+			return 0, io.EOF
+		}
+		n := r.size
+		if r.left > 0 && r.left < int64(n) {
+			n = int32(r.left)
+		}
+		data, count, err := r.read(r.pos, n)
+		if err != nil {
+			return 0, err
+		}
+		if count == 0 {
+			return 0, io.EOF
+		}
+		r.pos += count
+		if r.left > 0 {
+			r.left -= count
+		}
+		r.buf = data
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// lobWriter 按块顺序写入大字段
+type lobWriter struct {
+	write func(pos int, p []byte) (int, error) // 返回写入的长度(CLOB 为字符数)
+	pos   int
+	char  bool
+	rest  []byte // CLOB 中跨两次 Write 的不完整字符
+}
+
+// Write 写入失败时返回 p 中已写入的字节数, 上次 Write 留下的不完整字符不计入
+func (w *lobWriter) Write(p []byte) (int, error) {
+	data := p
+	prefix, done := 0, 0
+	if w.char {
+		prefix = len(w.rest)
+		data = append(w.rest, p...)
+		end := len(data)
+		if i := lastRuneStart(data); !utf8.FullRune(data[i:]) {
+			end = i
+		}
+		data, w.rest = data[:end], append([]byte(nil), data[end:]...)
+	}
+	for len(data) > 0 {
+		n := lobWriteChunk
+		if n > len(data) {
+			n = len(data)
+		}
+		if w.char {
+			// 不能把一个字符拆到两块中
+			for n < len(data) && !utf8.RuneStart(data[n]) {
+				n--
+			}
+		}
+		written, err := w.write(w.pos, data[:n])
+		if err != nil {
+			if done -= prefix; done < 0 {
+				done = 0
+			}
+			return done, err
+		}
+		done += n
+		if w.char {
+			written = utf8.RuneCount(data[:n])
+		}
+		w.pos += written
+		data = data[n:]
+	}
+	return len(p), nil
+}
+
+// Close 检查 CLOB 是否还有未写完的字符, 不关闭大字段本身
+func (w *lobWriter) Close() error {
+	if len(w.rest) > 0 {
+		return errClobPartial
+	}
+	return nil
+}
+
+func lastRuneStart(b []byte) int {
+	i := len(b) - 1
+	for i > 0 && !utf8.RuneStart(b[i]) {
+		i--
+	}
+	if i < 0 {
+		return 0
+	}
+	return i
+}
+
+// NewReader 从 pos(从 1 开始)读取 length 字节, length 小于 0 时读到末尾.
+// 每次向服务器读取一块, 不会把整个 BLOB 装入内存
+func (blob *DmBlob) NewReader(pos int64, length int64) (io.Reader, error) {
+	if err := blob.checkValid(); err != nil {
+		return nil, err
+	}
+	if err := blob.checkFreed(); err != nil {
+		return nil, err
+	}
+	if pos < 1 {
+		return nil, ECGO_INVALID_LENGTH_OR_OFFSET.throw()
+	}
+	if length < 0 {
+		length = -1
+	}
+	return &lobReader{
+		read: func(pos int64, n int32) ([]byte, int64, error) {
+			total, err := blob.GetLength()
+			if err != nil || pos > total {
+				return nil, 0, err
+			}
+			data, err := blob.getBytes(pos, n)
+			return data, int64(len(data)), err
+		},
+		pos:  pos,
+		left: length,
+		size: blobReadChunk,
+	}, nil
+}
+
+// NewWriter 从 pos(从 1 开始)开始按块写入, 写入远端大字段时每块一次请求
+func (blob *DmBlob) NewWriter(pos int64) (io.WriteCloser, error) {
+	if err := blob.checkValid(); err != nil {
+		return nil, err
+	}
+	if pos < 1 {
+		return nil, ECGO_INVALID_LENGTH_OR_OFFSET.throw()
+	}
+	return &lobWriter{write: blob.Write, pos: int(pos)}, nil
+}
+
+// NewReader 从第 pos 个字符(从 1 开始)读取 length 个字符, 以 UTF-8 返回, length 小于 0 时读到末尾
+func (clob *DmClob) NewReader(pos int64, length int64) (io.Reader, error) {
+	if err := clob.checkValid(); err != nil {
+		return nil, err
+	}
+	if err := clob.checkFreed(); err != nil {
+		return nil, err
+	}
+	if pos < 1 {
+		return nil, ECGO_INVALID_LENGTH_OR_OFFSET.throw()
+	}
+	if length < 0 {
+		length = -1
+	}
+	return &lobReader{
+		read: func(pos int64, n int32) ([]byte, int64, error) {
+			s, err := clob.getSubString(pos, n)
+			return []byte(s), int64(utf8.RuneCountInString(s)), err
+		},
+		pos:  pos,
+		left: length,
+		size: clobReadChunk,
+	}, nil
+}
+
+// NewWriter 从第 pos 个字符(从 1 开始)写入 UTF-8 数据, 写完需调用 Close 检查是否有不完整的字符
+func (clob *DmClob) NewWriter(pos int64) (io.WriteCloser, error) {
+	if err := clob.checkValid(); err != nil {
+		return nil, err
+	}
+	if pos < 1 {
+		return nil, ECGO_INVALID_LENGTH_OR_OFFSET.throw()
+	}
+	return &lobWriter{
+		write: func(pos int, p []byte) (int, error) { return clob.WriteString(pos, string(p)) },
+		pos:   int(pos),
+		char:  true,
+	}, nil
+}
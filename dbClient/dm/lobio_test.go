@@ -0,0 +1,115 @@
+package dm
+
+import (
+	"bytes"
+	"database/sql"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/jifuy/commongo/dbClient/dm/dmtest"
+)
+
+func newLobServer(t *testing.T) (*dmtest.Server, *sql.DB) {
+	srv, err := dmtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.Close)
+	db, err := sql.Open("dm", srv.DSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return srv, db
+}
+
+func TestLobReadWrite(t *testing.T) {
+	srv, db := newLobServer(t)
+	data := bytes.Repeat([]byte("0123456789"), 10000)
+	text := strings.Repeat("达梦数据库", 10000)
+	srv.Handle("select b, c from doc", &dmtest.Result{
+		Columns: []dmtest.Column{{Name: "B", Type: dmtest.Blob}, {Name: "C", Type: dmtest.Clob}},
+		Rows:    [][]interface{}{{data, text}},
+	})
+
+	var blob DmBlob
+	var clob DmClob
+	if err := db.QueryRow("select b, c from doc").Scan(&blob, &clob); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := blob.NewReader(11, 50000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil || !bytes.Equal(got, data[10:50010]) {
+		t.Fatalf("blob read %d bytes, %v", len(got), err)
+	}
+	r, err = clob.NewReader(1, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = io.ReadAll(r)
+	if err != nil || string(got) != text {
+		t.Fatalf("clob read %d bytes, %v", len(got), err)
+	}
+
+	// 逐字节写入, 检查跨块和拆开的 UTF-8 字符
+	w, err := clob.NewWriter(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = io.Copy(w, iotest.OneByteReader(strings.NewReader("更新"))); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := srv.Lob(clob.blobId); !strings.HasPrefix(string(got), "达梦更新库达梦") {
+		t.Fatalf("clob = %.30s", got)
+	}
+	w, err = blob.NewWriter(int64(len(data)) + 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tail := bytes.Repeat([]byte{'x'}, 40000)
+	if _, err = w.Write(tail); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := srv.Lob(blob.blobId); !bytes.Equal(got, append(data, tail...)) {
+		t.Fatalf("blob length = %d", len(got))
+	}
+}
+
+func TestLobReaderBind(t *testing.T) {
+	srv, db := newLobServer(t)
+	srv.SetParamTypes("insert into doc(id, b) values(?, ?)", dmtest.BigInt, dmtest.Blob)
+	data := bytes.Repeat([]byte("abc"), 30000)
+	// reader 每次只返回部分数据时也要读完整
+	if _, err := db.Exec("insert into doc(id, b) values(?, ?)", 1, iotest.HalfReader(bytes.NewReader(data))); err != nil {
+		t.Fatal(err)
+	}
+	qs := srv.Queries()
+	args := qs[len(qs)-1].Args
+	if len(args) != 1 || !bytes.Equal(args[0][1].([]byte), data) {
+		t.Fatalf("args = %v", args)
+	}
+}
+
+func TestLobWriterPartial(t *testing.T) {
+	calls := 0
+	w := &lobWriter{pos: 1, write: func(pos int, p []byte) (int, error) {
+		if calls++; calls == 2 {
+			return 0, io.ErrUnexpectedEOF
+		}
+		return len(p), nil
+	}}
+	// 第二块写入失败, 返回第一块的长度
+	n, err := w.Write(make([]byte, 3*lobWriteChunk))
+	if err != io.ErrUnexpectedEOF || n != lobWriteChunk {
+		t.Fatalf("write = %d, %v", n, err)
+	}
+}
@@ -74,6 +74,7 @@ type DmConnection struct {
 	sessionID          int64
 	autoCommit         bool
 	isBatch            bool
+	endpoint           string // 建立连接时的 host:port, 连接器的地址会随其他连接切换
 
 	watching bool
 	watcher  chan<- context.Context
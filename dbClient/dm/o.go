@@ -415,6 +415,8 @@ type DmConnector struct {
 	statSqlMaxCount int
 
 	statSqlRemoveMode int
+
+	config *Config
 }
 
 func (c *DmConnector) init() *DmConnector {
@@ -717,7 +719,14 @@ func (c *DmConnector) parseDSN(dsn string) (*Properties, string, error) {
 	return dsnProps, url.Host, nil
 }
 
+// BuildDSN 还原创建 connector 时的配置, 可再次用于 sql.Open.
+// DSN 含 Config 不识别的参数或配置已失效时只还原用户、地址和连接超时
 func (c *DmConnector) BuildDSN() string {
+	if c.config != nil {
+		if dsn, err := c.config.FormatDSN(); err == nil {
+			return dsn
+		}
+	}
 	var buf bytes.Buffer
 
 	buf.WriteString("dm://")
@@ -863,6 +872,7 @@ func (c *DmConnector) connectSingle(ctx context.Context) (*DmConnection, error)
 		dc.reset()
 	}
 
+	dc.endpoint = c.host + ":" + strconv.Itoa(int(c.port))
 	dc.Access, err = dm_build_14(dc)
 	if err != nil {
 		return nil, err
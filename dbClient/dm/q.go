@@ -81,5 +81,7 @@ func (d *DmDriver) openConnector(dsn string) (*DmConnector, error) {
 		return nil, err
 	}
 	connector.createFilterChain(connector, nil)
+	// 驱动接受 Config 不识别的参数, 此时 BuildDSN 按连接的属性还原
+	connector.config, _ = ParseDSN(dsn)
 	return connector, nil
 }
@@ -0,0 +1,270 @@
+package dm
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// 结构体字段通过 dm 标签控制映射: `dm:"-"` 跳过该字段, 其余字段按定义顺序对应对象类型的属性
+const typeMapTag = "dm"
+
+var (
+	timeType  = reflect.TypeOf(time.Time{})
+	bytesType = reflect.TypeOf([]byte(nil))
+)
+
+// ToDmArray 把 Go 切片转换为库中数组类型 typeName 的值, 元素为结构体或切片时按嵌套的对象/数组类型转换.
+//
+// 例如 create or replace type ids is array int[]; 对应 dm.ToDmArray("ids", []int{1, 2})
+func ToDmArray(typeName string, slice interface{}) (*DmArray, error) {
+	rv := reflect.Indirect(reflect.ValueOf(slice))
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, fmt.Errorf("dm: ToDmArray needs a slice, got %T", slice)
+	}
+	elements, err := toElements(rv)
+	if err != nil {
+		return nil, err
+	}
+	return NewDmArray(typeName, elements.([]interface{})), nil
+}
+
+// ToDmStruct 把结构体转换为库中对象类型 typeName 的值, 字段按定义顺序对应对象的属性.
+//
+// 例如 create or replace type point as object (x int, y int); 对应 dm.ToDmStruct("point", Point{X: 1, Y: 2})
+func ToDmStruct(typeName string, v interface{}) (*DmStruct, error) {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("dm: ToDmStruct needs a struct, got %T", v)
+	}
+	elements, err := toElements(rv)
+	if err != nil {
+		return nil, err
+	}
+	return NewDmStruct(typeName, elements.([]interface{})), nil
+}
+
+// ScanArray 把数组类型的值赋给 dest, dest 为切片指针
+func ScanArray(src *DmArray, dest interface{}) error {
+	rv := reflect.ValueOf(dest)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return ECGO_STORE_IN_NIL_POINTER.throw()
+	}
+	return assignValue(rv.Elem(), src)
+}
+
+// ScanStruct 把对象类型的值赋给 dest, dest 为结构体指针
+func ScanStruct(src *DmStruct, dest interface{}) error {
+	rv := reflect.ValueOf(dest)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return ECGO_STORE_IN_NIL_POINTER.throw()
+	}
+	return assignValue(rv.Elem(), src)
+}
+
+// mappedFields 返回参与映射的字段下标
+func mappedFields(t reflect.Type) []int {
+	var idx []int
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" || f.Tag.Get(typeMapTag) == "-" {
+			continue
+		}
+		idx = append(idx, i)
+	}
+	return idx
+}
+
+// toElements 把结构体和切片递归展开为驱动构造 DmStruct/DmArray 所用的 []interface{}
+func toElements(rv reflect.Value) (interface{}, error) {
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil, nil
+		}
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() {
+		return nil, nil
+	}
+	if rv.CanInterface() {
+		switch v := rv.Interface().(type) {
+		case DmArray, DmStruct, driver.Valuer:
+			return v, nil
+		}
+	}
+	switch {
+	case rv.Type() == timeType || rv.Type() == bytesType:
+		return rv.Interface(), nil
+	case rv.Kind() == reflect.Struct:
+		fields := mappedFields(rv.Type())
+		out := make([]interface{}, len(fields))
+		for i, f := range fields {
+			v, err := toElements(rv.Field(f))
+			if err != nil {
+				return nil, err
+			}
+			out[i] = v
+		}
+		return out, nil
+	case rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return nil, nil
+		}
+		out := make([]interface{}, rv.Len())
+		for i := range out {
+			v, err := toElements(rv.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			out[i] = v
+		}
+		return out, nil
+	case rv.Kind() == reflect.Int || rv.Kind() == reflect.Uint:
+		return rv.Convert(reflect.TypeOf(int64(0))).Interface(), nil
+	}
+	return rv.Interface(), nil
+}
+
+// assignValue 把驱动返回的值赋给 dst, 对象和数组按结构体字段顺序和切片递归赋值
+func assignValue(dst reflect.Value, src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	case DmArray:
+		return assignValue(dst, &v)
+	case DmStruct:
+		return assignValue(dst, &v)
+	case *DmArray:
+		if !v.Valid {
+			dst.Set(reflect.Zero(dst.Type()))
+			return nil
+		}
+		items, err := arrayItems(v)
+		if err != nil {
+			return err
+		}
+		return assignValue(dst, items)
+	case *DmStruct:
+		if !v.Valid {
+			dst.Set(reflect.Zero(dst.Type()))
+			return nil
+		}
+		attrs, err := structAttrs(v)
+		if err != nil {
+			return err
+		}
+		return assignValue(dst, attrs)
+	}
+
+	if dst.Kind() == reflect.Ptr {
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		return assignValue(dst.Elem(), src)
+	}
+	if dst.Kind() == reflect.Interface {
+		dst.Set(reflect.ValueOf(src))
+		return nil
+	}
+
+	sv := reflect.ValueOf(src)
+	if (sv.Kind() == reflect.Slice || sv.Kind() == reflect.Array) && sv.Type() != bytesType {
+		switch dst.Kind() {
+		case reflect.Struct:
+			fields := mappedFields(dst.Type())
+			if len(fields) != sv.Len() {
+				return fmt.Errorf("dm: %s has %d mapped fields, value has %d attributes", dst.Type(), len(fields), sv.Len())
+			}
+			for i, f := range fields {
+				if err := assignValue(dst.Field(f), sv.Index(i).Interface()); err != nil {
+					return fmt.Errorf("dm: field %s: %w", dst.Type().Field(f).Name, err)
+				}
+			}
+			return nil
+		case reflect.Slice:
+			out := reflect.MakeSlice(dst.Type(), sv.Len(), sv.Len())
+			for i := 0; i < sv.Len(); i++ {
+				if err := assignValue(out.Index(i), sv.Index(i).Interface()); err != nil {
+					return err
+				}
+			}
+			dst.Set(out)
+			return nil
+		case reflect.Array:
+			if sv.Len() > dst.Len() {
+				return fmt.Errorf("dm: %d items overflow %s", sv.Len(), dst.Type())
+			}
+			for i := 0; i < sv.Len(); i++ {
+				if err := assignValue(dst.Index(i), sv.Index(i).Interface()); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	switch {
+	case sv.Type().AssignableTo(dst.Type()):
+		dst.Set(sv)
+		return nil
+	case isNumberKind(sv.Kind()) && isNumberKind(dst.Kind()):
+		dst.Set(sv.Convert(dst.Type()))
+		return nil
+	case sv.Kind() == reflect.String && dst.Kind() == reflect.String:
+		dst.SetString(sv.String())
+		return nil
+	}
+	if s, ok := src.(fmt.Stringer); ok {
+		// DmDecimal 等以字符串形式转换
+		switch dst.Kind() {
+		case reflect.String:
+			dst.SetString(s.String())
+			return nil
+		case reflect.Float32, reflect.Float64:
+			f, err := strconv.ParseFloat(s.String(), 64)
+			if err != nil {
+				return err
+			}
+			dst.SetFloat(f)
+			return nil
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n, err := strconv.ParseInt(s.String(), 10, 64)
+			if err != nil {
+				return err
+			}
+			dst.SetInt(n)
+			return nil
+		}
+	}
+	return fmt.Errorf("dm: cannot assign %T to %s", src, dst.Type())
+}
+
+// arrayItems 返回数组的元素, 未经连接绑定的值返回构造时传入的元素
+func arrayItems(da *DmArray) (interface{}, error) {
+	if len(da.m_arrData) == 0 && da.m_objArray == nil {
+		if da.elements == nil {
+			return []interface{}{}, nil
+		}
+		return da.elements, nil
+	}
+	items, err := da.GetArray()
+	if err != nil || items == nil {
+		return []interface{}{}, err
+	}
+	return items, nil
+}
+
+// structAttrs 返回对象的属性, 未经连接绑定的值返回构造时传入的元素
+func structAttrs(ds *DmStruct) ([]interface{}, error) {
+	if len(ds.m_attribs) == 0 {
+		return ds.elements, nil
+	}
+	return ds.GetAttributes()
+}
+
+func isNumberKind(k reflect.Kind) bool {
+	return k >= reflect.Int && k <= reflect.Float64
+}
@@ -0,0 +1,49 @@
+package dm
+
+import (
+	"reflect"
+	"testing"
+)
+
+type testPoint struct {
+	X, Y int32
+}
+
+type testShape struct {
+	Name   string
+	Points []testPoint
+	Area   *float64
+	Cache  string `dm:"-"`
+	hidden int
+}
+
+func TestTypeMap(t *testing.T) {
+	area := 1.5
+	shape := testShape{Name: "tri", Points: []testPoint{{1, 2}, {3, 4}}, Area: &area, Cache: "x", hidden: 1}
+	ds, err := ToDmStruct("shape", &shape)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{"tri", []interface{}{[]interface{}{int32(1), int32(2)}, []interface{}{int32(3), int32(4)}}, 1.5}
+	if ds.typeName != "shape" || !reflect.DeepEqual(ds.elements, want) {
+		t.Fatalf("elements = %#v", ds.elements)
+	}
+	if _, err = ToDmArray("shapes", shape); err == nil {
+		t.Fatal("expected error for non-slice")
+	}
+
+	// 驱动返回的属性: 嵌套对象为 *DmStruct, 数值类型可能与字段不同
+	attrs := []interface{}{"sq", NewDmArray("points", []interface{}{
+		NewDmStruct("point", []interface{}{int64(5), int64(6)}),
+	}), nil}
+	var got testShape
+	if err = assignValue(reflect.ValueOf(&got).Elem(), attrs); err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "sq" || !reflect.DeepEqual(got.Points, []testPoint{{5, 6}}) || got.Area != nil {
+		t.Fatalf("got %+v", got)
+	}
+	if err = ScanStruct(NewDmStruct("shape", attrs), nil); err == nil {
+		t.Fatal("expected error for nil dest")
+	}
+}
@@ -7,6 +7,8 @@ package dm
 
 import (
 	"bytes"
+	"database/sql/driver"
+	"errors"
 	"fmt"
 	"github.com/jifuy/commongo/dbClient/dm/i18n"
 	"runtime"
@@ -79,6 +81,29 @@ var (
 	EC_BP_WITH_ERROR         = newDmError(121, "warning.bpWithErr")
 )
 
+// 错误分类, 可通过 errors.Is(err, dm.ErrDeadlock) 判断服务端/驱动返回的错误类型
+var (
+	ErrUniqueViolation = errors.New("dm: unique constraint violated")
+	ErrDeadlock        = errors.New("dm: deadlock detected")
+	ErrLockTimeout     = errors.New("dm: lock wait timeout")
+	ErrConnLost        = errors.New("dm: connection lost")
+	ErrAuthFailed      = errors.New("dm: authentication failed")
+)
+
+// 错误码 -> 错误分类, 服务端错误码可对照 V$ERR_INFO
+var errCodeKinds = map[int32]error{
+	-6602: ErrUniqueViolation, // 违反唯一性约束
+	-6403: ErrDeadlock,        // 死锁
+	-6404: ErrLockTimeout,     // 锁超时
+	-2501: ErrAuthFailed,      // 用户名或密码错误
+
+	ECGO_OSAUTH_ERROR.ErrCode:             ErrAuthFailed,
+	ECGO_COMMUNITION_ERROR.ErrCode:        ErrConnLost,
+	ECGO_INVALID_CONN.ErrCode:             ErrConnLost,
+	ECGO_CONNECTION_SWITCHED.ErrCode:      ErrConnLost,
+	ECGO_CONNECTION_SWITCH_FAILED.ErrCode: ErrConnLost,
+}
+
 type DmError struct {
 	ErrCode int32
 	ErrText string
@@ -123,6 +148,43 @@ func (dmError *DmError) Error() string {
 	return fmt.Sprintf("Error %d: %s", dmError.ErrCode, i18n.Get(dmError.ErrText, Locale)) + dmError.detail + "\n" + "stack info:\n" + dmError.FormatStack()
 }
 
+// Is 支持 errors.Is 按错误分类或错误码比较
+func (dmError *DmError) Is(target error) bool {
+	if kind, ok := errCodeKinds[dmError.ErrCode]; ok && kind == target {
+		return true
+	}
+	if t, ok := target.(*DmError); ok && t != nil {
+		return t.ErrCode == dmError.ErrCode
+	}
+	return false
+}
+
+// Kind 返回错误所属分类, 未归类返回 nil
+func (dmError *DmError) Kind() error {
+	return errCodeKinds[dmError.ErrCode]
+}
+
+// ErrorKind 返回 err 所属的错误分类, 未归类返回 nil
+func ErrorKind(err error) error {
+	if errors.Is(err, driver.ErrBadConn) {
+		return ErrConnLost
+	}
+	var dmErr *DmError
+	if errors.As(err, &dmErr) {
+		return dmErr.Kind()
+	}
+	return nil
+}
+
+// IsRetryable 死锁、锁超时、连接断开可重试, 其余错误直接失败
+func IsRetryable(err error) bool {
+	switch ErrorKind(err) {
+	case ErrDeadlock, ErrLockTimeout, ErrConnLost:
+		return true
+	}
+	return false
+}
+
 // 扩充ErrText
 func (dmError *DmError) addDetail(detail string) *DmError {
 	dmError.detail = detail
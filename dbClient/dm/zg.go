@@ -41,12 +41,12 @@ func (rf *reconnectFilter) autoReconnect(connection *DmConnection, err error) er
 // 一定抛错
 func (rf *reconnectFilter) reconnect(connection *DmConnection, reason string) error {
 	// 读写分离，重连需要处理备机
-	var err error
-	if connection.dmConnector.rwSeparate {
-		err = RWUtil.reconnect(connection)
-	} else {
-		err = connection.reconnect()
-	}
+	err := connection.reconnectWithEvent(reason, func() error {
+		if connection.dmConnector.rwSeparate {
+			return RWUtil.reconnect(connection)
+		}
+		return connection.reconnect()
+	})
 
 	if err != nil {
 		return ECGO_CONNECTION_SWITCH_FAILED.addDetailln(reason).throw()
@@ -122,7 +122,7 @@ func (rf *reconnectFilter) checkAndRecover(conn *DmConnection) error {
 		return nil
 	}
 	// do reconnect
-	return conn.reconnect()
+	return conn.reconnectWithEvent("ep recovered", conn.reconnect)
 }
 
 // DmDriver
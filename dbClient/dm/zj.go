@@ -821,6 +821,9 @@ func (G2DB g2db) fromReader(val io.Reader, param parameter, conn *DmConnection)
 		} else {
 			ret = binder.readAll()
 		}
+		if binder.err != nil {
+			return nil, binder.err
+		}
 	default:
 		return nil, ECGO_DATA_CONVERTION_ERROR.throw()
 	}
@@ -2436,7 +2436,7 @@ func (dm_build_805 *dm_build_788) dm_build_397() error {
 
 	dm_build_805.dm_build_412.dm_build_5.Dm_build_1298(int32(dm_build_805.dm_build_791))
 	dm_build_805.dm_build_412.dm_build_5.Dm_build_1298(int32(dm_build_805.dm_build_794))
-	dm_build_805.dm_build_412.dm_build_5.Dm_build_1326(dm_build_805.dm_build_792)
+	dm_build_805.dm_build_412.dm_build_5.Dm_build_1326(dm_build_805.dm_build_792[dm_build_805.dm_build_793 : dm_build_805.dm_build_793+dm_build_805.dm_build_794])
 
 	if dm_build_805.dm_build_412.dm_build_6.NewLobFlag {
 		dm_build_805.dm_build_412.dm_build_5.Dm_build_1294(dm_build_805.dm_build_789.exGroupId)
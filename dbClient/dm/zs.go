@@ -155,11 +155,12 @@ func (b *offRowClobBinder) getObj() interface{} {
 
 type offRowReaderBinder struct {
 	*offRowBinder
+	err error // 读取 reader 出错时记录, 发送完数据后返回
 }
 
 func newOffRowReaderBinder(reader io.Reader, encoding string) *offRowReaderBinder {
 	var binder = &offRowReaderBinder{
-		newOffRowBinder(reader, encoding, int64(IGNORE_TARGET_LENGTH)),
+		offRowBinder: newOffRowBinder(reader, encoding, int64(IGNORE_TARGET_LENGTH)),
 	}
 	binder.read(binder.buffer)
 	binder.offRow = binder.buffer.Dm_build_1174() > Dm_build_384
@@ -174,13 +175,16 @@ func (b *offRowReaderBinder) read(buf *Dm_build_1169) {
 		var readLen = READ_LEN
 		var reader = b.obj.(io.Reader)
 		var bytes = make([]byte, readLen)
-		readLen, err = reader.Read(bytes)
-		if err == io.EOF {
+		// reader 可能分多次返回数据, 读满一块或遇到 EOF 才算结束
+		readLen, err = io.ReadFull(reader, bytes)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			b.readOver = true
+		} else if err != nil {
+			b.err = err
 			b.readOver = true
-			return
 		}
 		b.position += int32(readLen)
-		if readLen < len(bytes) || b.targetLength != int64(IGNORE_TARGET_LENGTH) && int64(b.position) == b.targetLength {
+		if b.targetLength != int64(IGNORE_TARGET_LENGTH) && int64(b.position) == b.targetLength {
 			b.readOver = true
 		}
 		buf.Dm_build_1195(bytes[0:readLen], 0, readLen)
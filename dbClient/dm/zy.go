@@ -82,6 +82,9 @@ func (RWUtil rwUtil) recoverStandby(connection *DmConnection) error {
 
 	err := RWUtil.connectStandby(connection)
 	connection.rwInfo.tryRecoverTs = ts
+	if err == nil && RWUtil.isStandbyAlive(connection) {
+		emitEvent(Event{Type: EventStandbyRecovered, Addr: connection.rwInfo.connStandby.addr()})
+	}
 
 	return err
 }
@@ -152,6 +155,9 @@ func (RWUtil rwUtil) chooseValidStandby(connection *DmConnection) (*ep, error) {
 
 func (RWUtil rwUtil) afterExceptionOnStandby(connection *DmConnection, e error) {
 	if e.(*DmError).ErrCode == ECGO_COMMUNITION_ERROR.ErrCode {
+		if connection.rwInfo.connStandby != nil {
+			emitEvent(Event{Type: EventStandbyLost, Addr: connection.rwInfo.connStandby.addr(), Err: e})
+		}
 		RWUtil.removeStandby(connection)
 	}
 }
@@ -365,6 +371,9 @@ func (RWUtil rwUtil) distributeSqlByConn(conn *DmConnection, query string) RWSit
 	} else {
 		conn.rwInfo.connCurrent = conn.rwInfo.connStandby
 	}
+	if hasEventHandler() {
+		emitEvent(Event{Type: EventRoute, Addr: conn.rwInfo.connCurrent.addr(), Site: dest, SQL: query})
+	}
 	return dest
 }
 
@@ -401,6 +410,9 @@ func (RWUtil rwUtil) distributeSqlByStmt(stmt *DmStatement) RWSiteEnum {
 	} else {
 		stmt.rwInfo.stmtCurrent = stmt.rwInfo.stmtStandby
 	}
+	if hasEventHandler() {
+		emitEvent(Event{Type: EventRoute, Addr: stmt.rwInfo.stmtCurrent.dmConn.addr(), Site: dest, SQL: stmt.nativeSql})
+	}
 	return dest
 }
 
@@ -0,0 +1,66 @@
+package dbClient
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+
+	"github.com/jifuy/commongo/dbClient/dm"
+	"github.com/jifuy/commongo/loging"
+)
+
+// CopyLob 查询单行单列的大字段并写入 w, 返回写入的字节数.
+// 达梦的 BLOB/CLOB 按块从服务器读取, 其他库的值按 []byte 一次写入.
+// 写入大字段时直接把 io.Reader 作为 Exec 的参数, 达梦驱动会分块发送
+func CopyLob(ctx context.Context, logging loging.Logger, SqlDb *sql.DB, w io.Writer, query string, args ...interface{}) (int64, error) {
+	// 大字段依赖查询所在的连接读取, 读完之前不能归还连接池
+	conn, err := SqlDb.Conn(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	rows, err := conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		logging.Error("[Sql] CopyLob Error : " + err.Error())
+		return 0, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		if err = rows.Err(); err == nil {
+			err = sql.ErrNoRows
+		}
+		return 0, err
+	}
+	var v interface{}
+	if err = rows.Scan(&v); err != nil {
+		return 0, err
+	}
+
+	var r io.Reader
+	switch v := v.(type) {
+	case nil:
+		return 0, nil
+	case *dm.DmBlob:
+		r, err = v.NewReader(1, -1)
+	case *dm.DmClob:
+		r, err = v.NewReader(1, -1)
+	case []byte:
+		n, err := w.Write(v)
+		return int64(n), err
+	case string:
+		n, err := io.WriteString(w, v)
+		return int64(n), err
+	default:
+		return 0, fmt.Errorf("unsupported lob type %T", v)
+	}
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(w, r)
+	if err != nil {
+		logging.Error("[Sql] CopyLob Error : " + err.Error())
+	}
+	return n, err
+}
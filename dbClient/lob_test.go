@@ -0,0 +1,38 @@
+package dbClient
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/jifuy/commongo/dbClient/dm/dmtest"
+	"github.com/jifuy/commongo/loging"
+)
+
+func TestCopyLob(t *testing.T) {
+	srv, err := dmtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	data := bytes.Repeat([]byte{1, 2, 3}, 50000)
+	srv.Handle("select content from doc where id = ?", &dmtest.Result{
+		Columns: []dmtest.Column{{Name: "CONTENT", Type: dmtest.Blob}},
+		Rows:    [][]interface{}{{data}},
+	})
+
+	db, err := sql.Open("dm", srv.DSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var buf bytes.Buffer
+	n, err := CopyLob(context.Background(), loging.NewStd(), db, &buf, "select content from doc where id = ?", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(data)) || !bytes.Equal(buf.Bytes(), data) {
+		t.Fatalf("copied %d bytes", n)
+	}
+}
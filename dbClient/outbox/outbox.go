@@ -0,0 +1,308 @@
+package outbox
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/jifuy/commongo/loging"
+	"github.com/jifuy/commongo/mq/model"
+)
+
+// 发送状态
+const (
+	StatusPending = 0
+	StatusSent    = 1
+	StatusFailed  = 2 // 重试次数耗尽, 不再发送
+)
+
+// Producer 发送消息, mq.MessageProducer 实现了该接口
+type Producer interface {
+	SendMessage(ctx context.Context, msg *model.Message) error
+}
+
+// Execer 写入发件箱的事务, 一般为 *sql.Tx
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+type Config struct {
+	Table                 string // 发件箱表名, 默认 mq_outbox
+	BatchSize             int    // 每轮最多读取的待发送消息数, 默认 100
+	IntervalMilliSecond   int    // 轮询间隔, 默认 1000
+	LeaseMilliSecond      int    // 领取消息后的租期, 租期内未完成的消息由其他实例重新领取, 默认 30000
+	MaxAttempts           int    // 最多发送次数, 耗尽后标记为 StatusFailed, 同一聚合的后续消息继续发送; 默认 10
+	BackoffMilliSecond    int    // 首次重试间隔, 之后翻倍, 默认 1000
+	MaxBackoffMilliSecond int    // 重试间隔上限, 默认 60000
+}
+
+// Outbox 事务发件箱: 业务数据和待发送消息在同一事务中写入, Relay 轮询发送并标记为已发送.
+// 同一聚合 key 的消息按写入顺序逐条发送, 前一条未发送成功时不发送后面的消息; key 为空的消息不保证顺序.
+// 多个实例可以同时 Relay, 消息至少发送一次
+type Outbox struct {
+	db    *sql.DB
+	p     Producer
+	cfg   Config
+	owner string
+}
+
+func New(db *sql.DB, p Producer, cfg Config) *Outbox {
+	if cfg.Table == "" {
+		cfg.Table = "mq_outbox"
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.IntervalMilliSecond <= 0 {
+		cfg.IntervalMilliSecond = 1000
+	}
+	if cfg.LeaseMilliSecond <= 0 {
+		cfg.LeaseMilliSecond = 30000
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 10
+	}
+	if cfg.BackoffMilliSecond <= 0 {
+		cfg.BackoffMilliSecond = 1000
+	}
+	if cfg.MaxBackoffMilliSecond <= 0 {
+		cfg.MaxBackoffMilliSecond = 60000
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	return &Outbox{db: db, p: p, cfg: cfg, owner: hex.EncodeToString(id)}
+}
+
+// Schema 返回建表语句, dbType 为 mysql 或 dm, 与 dbClient.DbInfo.DbType 一致; 每条语句单独执行
+func Schema(dbType, table string) []string {
+	if table == "" {
+		table = "mq_outbox"
+	}
+	if dbType == "dm" {
+		return []string{fmt.Sprintf(`CREATE TABLE %s (
+	id BIGINT IDENTITY(1, 1) PRIMARY KEY,
+	aggregate_key VARCHAR(255) DEFAULT '' NOT NULL,
+	topic VARCHAR(255) NOT NULL,
+	msg_key VARCHAR(255) DEFAULT '' NOT NULL,
+	payload BLOB,
+	headers VARCHAR(4000) DEFAULT '' NOT NULL,
+	send_status INT DEFAULT 0 NOT NULL,
+	attempts INT DEFAULT 0 NOT NULL,
+	next_attempt BIGINT DEFAULT 0 NOT NULL,
+	claimed_by VARCHAR(64) DEFAULT '' NOT NULL,
+	lease_until BIGINT DEFAULT 0 NOT NULL,
+	last_error VARCHAR(1024) DEFAULT '' NOT NULL,
+	created_at BIGINT NOT NULL,
+	sent_at BIGINT DEFAULT 0 NOT NULL
+)`, table),
+			fmt.Sprintf(`CREATE INDEX idx_%s_status ON %s(send_status, id)`, table, table)}
+	}
+	return []string{fmt.Sprintf(`CREATE TABLE %s (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	aggregate_key VARCHAR(255) NOT NULL DEFAULT '',
+	topic VARCHAR(255) NOT NULL,
+	msg_key VARCHAR(255) NOT NULL DEFAULT '',
+	payload LONGBLOB,
+	headers VARCHAR(4000) NOT NULL DEFAULT '',
+	send_status INT NOT NULL DEFAULT 0,
+	attempts INT NOT NULL DEFAULT 0,
+	next_attempt BIGINT NOT NULL DEFAULT 0,
+	claimed_by VARCHAR(64) NOT NULL DEFAULT '',
+	lease_until BIGINT NOT NULL DEFAULT 0,
+	last_error VARCHAR(1024) NOT NULL DEFAULT '',
+	created_at BIGINT NOT NULL,
+	sent_at BIGINT NOT NULL DEFAULT 0,
+	KEY idx_%s_status (send_status, id)
+)`, table, table)}
+}
+
+// header 保存在 headers 列中的消息字段, 发送时还原
+type header struct {
+	Headers   map[string]string `json:"headers,omitempty"`
+	Tags      string            `json:"tags,omitempty"`
+	MessageID string            `json:"messageId,omitempty"`
+}
+
+// Add 在 tx 中写入待发送消息, 与业务数据一起提交或回滚. aggregateKey 相同的消息按写入顺序发送
+func (o *Outbox) Add(ctx context.Context, tx Execer, aggregateKey string, msg *model.Message) error {
+	h, err := json.Marshal(header{Headers: msg.Headers, Tags: msg.Tags, MessageID: msg.MessageID})
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "insert into "+o.cfg.Table+
+		"(aggregate_key, topic, msg_key, payload, headers, created_at) values(?, ?, ?, ?, ?, ?)",
+		aggregateKey, msg.Topic, msg.Key, msg.Value, string(h), time.Now().UnixMilli())
+	return err
+}
+
+// Run 按间隔发送待发送消息, 直到 ctx 结束
+func (o *Outbox) Run(ctx context.Context) error {
+	t := time.NewTicker(time.Duration(o.cfg.IntervalMilliSecond) * time.Millisecond)
+	defer t.Stop()
+	for {
+		if _, err := o.Relay(ctx); err != nil {
+			loging.Errorf("[Sql] outbox relay failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+type record struct {
+	id          int64
+	key         string
+	msg         *model.Message
+	attempts    int
+	nextAttempt int64
+	leaseUntil  int64
+}
+
+// Relay 发送一轮待发送消息, 返回发送成功的条数
+func (o *Outbox) Relay(ctx context.Context) (int, error) {
+	records, err := o.pending(ctx)
+	if err != nil {
+		return 0, err
+	}
+	// 按 id 顺序读取, 每个聚合第一条未完成的消息之后的消息本轮都不发送
+	blocked := make(map[string]bool)
+	n := 0
+	for _, r := range records {
+		if ctx.Err() != nil {
+			break
+		}
+		if r.key != "" && blocked[r.key] {
+			continue
+		}
+		ok, err := o.relay(ctx, r)
+		if err != nil {
+			return n, err
+		}
+		if !ok {
+			blocked[r.key] = true
+			continue
+		}
+		n++
+	}
+	return n, nil
+}
+
+// relay 领取并发送一条消息, 未领取到或发送失败时返回 false
+func (o *Outbox) relay(ctx context.Context, r record) (bool, error) {
+	now := time.Now().UnixMilli()
+	if r.nextAttempt > now || r.leaseUntil > now {
+		return false, nil
+	}
+	res, err := o.db.ExecContext(ctx, "update "+o.cfg.Table+" set claimed_by = ?, lease_until = ? where id = ? and send_status = ? and lease_until < ?",
+		o.owner, now+int64(o.cfg.LeaseMilliSecond), r.id, StatusPending, now)
+	if err != nil {
+		return false, err
+	}
+	if claimed, err := res.RowsAffected(); err != nil || claimed != 1 {
+		// 其他实例已领取
+		return false, err
+	}
+
+	if err = o.p.SendMessage(ctx, r.msg); err != nil {
+		return false, o.fail(ctx, r, err)
+	}
+	res, err = o.db.ExecContext(ctx, "update "+o.cfg.Table+" set send_status = ?, sent_at = ?, lease_until = 0 where id = ? and claimed_by = ?",
+		StatusSent, time.Now().UnixMilli(), r.id, o.owner)
+	if err != nil {
+		return false, err
+	}
+	if marked, err := res.RowsAffected(); err != nil || marked != 1 {
+		// 发送超过租期, 消息已由其他实例重新领取, 同一聚合的后续消息等它发送后再发送
+		loging.Warnf("[Sql] outbox message %d to %s sent after its lease expired", r.id, r.msg.Topic)
+		return false, err
+	}
+	return true, nil
+}
+
+// fail 记录发送失败, 按退避时间重试, 次数耗尽后标记为失败
+func (o *Outbox) fail(ctx context.Context, r record, cause error) error {
+	attempts := r.attempts + 1
+	status := StatusPending
+	if attempts >= o.cfg.MaxAttempts {
+		status = StatusFailed
+		loging.Errorf("[Sql] outbox message %d to %s failed after %d attempts: %v", r.id, r.msg.Topic, attempts, cause)
+	} else {
+		loging.Warnf("[Sql] outbox message %d to %s failed, attempt %d: %v", r.id, r.msg.Topic, attempts, cause)
+	}
+	backoff := time.Duration(o.cfg.MaxBackoffMilliSecond) * time.Millisecond
+	if attempts <= 20 {
+		if d := time.Duration(o.cfg.BackoffMilliSecond) * time.Millisecond << (attempts - 1); d < backoff {
+			backoff = d
+		}
+	}
+	msg := cause.Error()
+	if len(msg) > 1024 {
+		msg = msg[:1024]
+	}
+	_, err := o.db.ExecContext(ctx, "update "+o.cfg.Table+" set send_status = ?, attempts = ?, next_attempt = ?, last_error = ?, lease_until = 0 where id = ? and claimed_by = ?",
+		status, attempts, time.Now().Add(backoff).UnixMilli(), msg, r.id, o.owner)
+	return err
+}
+
+// pending 按 id 顺序读取待发送消息
+func (o *Outbox) pending(ctx context.Context) ([]record, error) {
+	rows, err := o.db.QueryContext(ctx, "select id, aggregate_key, topic, msg_key, payload, headers, attempts, next_attempt, lease_until from "+
+		o.cfg.Table+" where send_status = ? order by id limit ?", StatusPending, o.cfg.BatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var records []record
+	for rows.Next() {
+		var r record
+		var payload interface{}
+		var h string
+		r.msg = &model.Message{}
+		if err = rows.Scan(&r.id, &r.key, &r.msg.Topic, &r.msg.Key, &payload, &h, &r.attempts, &r.nextAttempt, &r.leaseUntil); err != nil {
+			return nil, err
+		}
+		// 达梦的 BLOB 依赖查询所在的连接读取, 在关闭结果集之前读完
+		if r.msg.Value, err = readLob(payload); err != nil {
+			return nil, err
+		}
+		var hd header
+		if h != "" {
+			if err = json.Unmarshal([]byte(h), &hd); err != nil {
+				return nil, fmt.Errorf("outbox message %d: invalid headers: %w", r.id, err)
+			}
+		}
+		r.msg.Headers, r.msg.Tags, r.msg.MessageID = hd.Headers, hd.Tags, hd.MessageID
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+// lob 达梦驱动返回的 BLOB/CLOB
+type lob interface {
+	NewReader(pos int64, length int64) (io.Reader, error)
+}
+
+func readLob(v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		return append([]byte(nil), v...), nil
+	case string:
+		return []byte(v), nil
+	case lob:
+		r, err := v.NewReader(1, -1)
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(r)
+	}
+	return nil, fmt.Errorf("unsupported payload type %T", v)
+}
@@ -0,0 +1,196 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/jifuy/commongo/dbClient/dm"
+	"github.com/jifuy/commongo/dbClient/dm/dmtest"
+	"github.com/jifuy/commongo/mq/model"
+)
+
+// fakeTable 按语句前缀模拟发件箱表
+type fakeTable struct {
+	mu   sync.Mutex
+	rows []map[string]interface{}
+}
+
+func (f *fakeTable) handle(q *dmtest.Query) *dmtest.Result {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	sql := strings.ToLower(q.SQL)
+	var args []interface{}
+	if len(q.Args) > 0 {
+		args = q.Args[0]
+	}
+	switch {
+	case strings.HasPrefix(sql, "insert into mq_outbox"):
+		f.rows = append(f.rows, map[string]interface{}{
+			"id": int64(len(f.rows) + 1), "key": args[0], "topic": args[1], "msg_key": args[2], "payload": args[3],
+			"headers": args[4], "status": int64(0), "attempts": int64(0), "next": int64(0), "owner": "", "lease": int64(0),
+		})
+		return &dmtest.Result{Affected: 1}
+	case strings.HasPrefix(sql, "select id, aggregate_key"):
+		res := &dmtest.Result{Columns: []dmtest.Column{
+			{Name: "ID", Type: dmtest.BigInt}, {Name: "AGGREGATE_KEY", Type: dmtest.Varchar}, {Name: "TOPIC", Type: dmtest.Varchar},
+			{Name: "MSG_KEY", Type: dmtest.Varchar}, {Name: "PAYLOAD", Type: dmtest.Blob}, {Name: "HEADERS", Type: dmtest.Varchar},
+			{Name: "ATTEMPTS", Type: dmtest.Int}, {Name: "NEXT_ATTEMPT", Type: dmtest.BigInt}, {Name: "LEASE_UNTIL", Type: dmtest.BigInt},
+		}}
+		for _, r := range f.rows {
+			if r["status"] == args[0] {
+				res.Rows = append(res.Rows, []interface{}{r["id"], r["key"], r["topic"], r["msg_key"], r["payload"], r["headers"], r["attempts"], r["next"], r["lease"]})
+			}
+		}
+		return res
+	case strings.HasPrefix(sql, "update mq_outbox set claimed_by"):
+		r := f.rows[args[2].(int64)-1]
+		if r["status"] != args[3] || r["lease"].(int64) >= args[4].(int64) {
+			return &dmtest.Result{Affected: 0}
+		}
+		r["owner"], r["lease"] = args[0], args[1]
+		return &dmtest.Result{Affected: 1}
+	case strings.HasPrefix(sql, "update mq_outbox set send_status = ?, sent_at"):
+		r := f.rows[args[2].(int64)-1]
+		if r["owner"] != args[3] {
+			return &dmtest.Result{Affected: 0}
+		}
+		r["status"], r["lease"] = args[0], int64(0)
+		return &dmtest.Result{Affected: 1}
+	case strings.HasPrefix(sql, "update mq_outbox set send_status = ?, attempts"):
+		r := f.rows[args[4].(int64)-1]
+		r["status"], r["attempts"], r["next"], r["lease"] = args[0], args[1], args[2], int64(0)
+		return &dmtest.Result{Affected: 1}
+	}
+	return nil
+}
+
+// fakeProducer 记录发送的消息, fail 中的 key 第一次发送失败
+type fakeProducer struct {
+	fail   map[string]bool
+	sent   []*model.Message
+	onSend func(msg *model.Message)
+}
+
+func (p *fakeProducer) SendMessage(ctx context.Context, msg *model.Message) error {
+	if p.onSend != nil {
+		p.onSend(msg)
+	}
+	if p.fail[msg.Key] {
+		delete(p.fail, msg.Key)
+		return errors.New("broker unavailable")
+	}
+	p.sent = append(p.sent, msg)
+	return nil
+}
+
+func TestRelay(t *testing.T) {
+	srv, err := dmtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	table := &fakeTable{}
+	srv.HandleFunc(table.handle)
+
+	db, err := sql.Open("dm", srv.DSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	p := &fakeProducer{fail: map[string]bool{"a1": true}}
+	o := New(db, p, Config{BackoffMilliSecond: 1})
+	ctx := context.Background()
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range []struct{ aggregate, key string }{{"a", "a1"}, {"b", "b1"}, {"a", "a2"}} {
+		msg := &model.Message{Topic: "unios-alarm-std", Key: m.key, Value: []byte("alarm " + m.key), Headers: map[string]string{"trace-id": m.key}}
+		if err = o.Add(ctx, tx, m.aggregate, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a1 发送失败, 同一聚合的 a2 本轮不发送
+	if n, err := o.Relay(ctx); err != nil || n != 1 {
+		t.Fatalf("relay = %d, %v", n, err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if n, err := o.Relay(ctx); err != nil || n != 2 {
+		t.Fatalf("relay = %d, %v", n, err)
+	}
+	if n, err := o.Relay(ctx); err != nil || n != 0 {
+		t.Fatalf("relay = %d, %v", n, err)
+	}
+	var keys []string
+	for _, m := range p.sent {
+		keys = append(keys, m.Key)
+	}
+	if strings.Join(keys, ",") != "b1,a1,a2" {
+		t.Fatalf("sent %v", keys)
+	}
+	if m := p.sent[2]; string(m.Value) != "alarm a2" || m.Headers["trace-id"] != "a2" || m.Topic != "unios-alarm-std" {
+		t.Fatalf("got %+v", m)
+	}
+	if table.rows[0]["attempts"] != int64(1) {
+		t.Fatalf("attempts = %v", table.rows[0]["attempts"])
+	}
+}
+
+func TestRelayLeaseLost(t *testing.T) {
+	srv, err := dmtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	table := &fakeTable{}
+	srv.HandleFunc(table.handle)
+
+	db, err := sql.Open("dm", srv.DSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	p := &fakeProducer{}
+	o := New(db, p, Config{})
+	ctx := context.Background()
+	for _, key := range []string{"a1", "a2"} {
+		if err = o.Add(ctx, db, "a", &model.Message{Topic: "unios-alarm-std", Key: key}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 发送 a1 时租期已过, 其他实例重新领取了它
+	p.onSend = func(msg *model.Message) {
+		if msg.Key == "a1" {
+			table.mu.Lock()
+			table.rows[0]["owner"] = "other"
+			table.mu.Unlock()
+		}
+	}
+	if n, err := o.Relay(ctx); err != nil || n != 0 {
+		t.Fatalf("relay = %d, %v", n, err)
+	}
+	if len(p.sent) != 1 || p.sent[0].Key != "a1" {
+		t.Fatalf("sent %v", p.sent)
+	}
+}
+
+func TestSchema(t *testing.T) {
+	for _, dbType := range []string{"mysql", "dm"} {
+		for _, stmt := range Schema(dbType, "") {
+			if strings.Contains(stmt, ";") {
+				t.Fatalf("%s: multiple statements in %q", dbType, stmt)
+			}
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package dbClient
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/jifuy/commongo/dbClient/dm"
+	"github.com/jifuy/commongo/loging"
+)
+
+// CallProcedure 调用存储过程, 参数依次为 in 和 out, 返回过程中 select 产生的结果集.
+//
+// out 的元素为指针(OUT 参数)或 sql.Out(In 为 true 时为 INOUT 参数).
+// 指向结构体或切片的指针按对象/数组类型的 OUT 参数接收, 结果按字段顺序赋值, 见 dm.ScanStruct;
+// in 中的对象/数组参数用 dm.ToDmStruct/dm.ToDmArray 构造
+func CallProcedure(ctx context.Context, logging loging.Logger, SqlDb *sql.DB, name string, in []interface{}, out []interface{}) ([][]map[string]interface{}, error) {
+	args := make([]interface{}, 0, len(in)+len(out))
+	args = append(args, in...)
+	type pending struct {
+		src  interface{}
+		dest interface{}
+	}
+	var converts []pending
+	for _, o := range out {
+		if v, ok := o.(sql.Out); ok {
+			args = append(args, v)
+			continue
+		}
+		switch typeMapKind(o) {
+		case reflect.Struct:
+			src := &dm.DmStruct{}
+			converts = append(converts, pending{src, o})
+			args = append(args, sql.Out{Dest: src})
+		case reflect.Slice:
+			src := &dm.DmArray{}
+			converts = append(converts, pending{src, o})
+			args = append(args, sql.Out{Dest: src})
+		default:
+			args = append(args, sql.Out{Dest: o})
+		}
+	}
+	query := "CALL " + name + "(" + strings.TrimSuffix(strings.Repeat("?, ", len(args)), ", ") + ")"
+
+	// OUT 参数在语句执行时赋值, 结果集读完之前不能归还连接池
+	conn, err := SqlDb.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var sets [][]map[string]interface{}
+	rows, err := conn.QueryContext(ctx, query, args...)
+	switch {
+	case errors.Is(err, dm.ECGO_NOT_QUERY_SQL):
+		// 无参数且不返回结果集的过程
+	case err != nil:
+		logging.Error("[Sql] CallProcedure Error : " + err.Error())
+		return nil, err
+	default:
+		defer rows.Close()
+		for {
+			set, err := scanRows(rows)
+			if err != nil {
+				logging.Error("[Sql] CallProcedure Error : " + err.Error())
+				return nil, err
+			}
+			if set != nil {
+				sets = append(sets, set)
+			}
+			if !rows.NextResultSet() {
+				break
+			}
+		}
+		if err = rows.Err(); err != nil {
+			logging.Error("[Sql] CallProcedure Error : " + err.Error())
+			return nil, err
+		}
+	}
+
+	for _, c := range converts {
+		switch src := c.src.(type) {
+		case *dm.DmStruct:
+			err = dm.ScanStruct(src, c.dest)
+		case *dm.DmArray:
+			err = dm.ScanArray(src, c.dest)
+		}
+		if err != nil {
+			logging.Error("[Sql] CallProcedure Error : " + err.Error())
+			return sets, err
+		}
+	}
+	return sets, nil
+}
+
+var (
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	valuerType  = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+)
+
+// typeMapKind 返回按对象/数组类型接收的 OUT 参数种类, 其他参数返回 reflect.Invalid.
+// sql.NullString、dm.DmDecimal 等实现了 sql.Scanner 或 driver.Valuer 的类型按普通参数接收
+func typeMapKind(o interface{}) reflect.Kind {
+	t := reflect.TypeOf(o)
+	if t == nil || t.Kind() != reflect.Ptr {
+		return reflect.Invalid
+	}
+	switch e := t.Elem(); {
+	case t.Implements(scannerType) || e.Implements(valuerType) || t.Implements(valuerType):
+	case e == reflect.TypeOf(time.Time{}):
+	case e.Kind() == reflect.Struct:
+		return reflect.Struct
+	case e.Kind() == reflect.Slice && e.Elem().Kind() != reflect.Uint8:
+		return reflect.Slice
+	}
+	return reflect.Invalid
+}
+
+// scanRows 读取当前结果集, 没有列时返回 nil
+func scanRows(rows *sql.Rows) ([]map[string]interface{}, error) {
+	columns, err := rows.Columns()
+	if err != nil || len(columns) == 0 {
+		return nil, err
+	}
+	set := []map[string]interface{}{}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		ptrs := make([]interface{}, len(columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err = rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		row := make(map[string]interface{}, len(columns))
+		for i, col := range columns {
+			row[col] = values[i]
+		}
+		set = append(set, row)
+	}
+	return set, rows.Err()
+}
@@ -0,0 +1,90 @@
+package dbClient
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"testing"
+
+	"github.com/jifuy/commongo/dbClient/dm/dmtest"
+	"github.com/jifuy/commongo/loging"
+)
+
+func TestCallProcedure(t *testing.T) {
+	srv, err := dmtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	const call = "CALL get_user(?, ?, ?)"
+	srv.SetParams(call,
+		dmtest.Param{Type: dmtest.Int},
+		dmtest.Param{Type: dmtest.Varchar, IO: dmtest.ParamOut},
+		dmtest.Param{Type: dmtest.BigInt, IO: dmtest.ParamInOut},
+	)
+	srv.Handle(call, &dmtest.Result{
+		Out:     []interface{}{"tom", 8},
+		Columns: []dmtest.Column{{Name: "ID", Type: dmtest.Int}},
+		Rows:    [][]interface{}{{1}, {2}},
+		Next: &dmtest.Result{
+			Columns: []dmtest.Column{{Name: "NAME", Type: dmtest.Varchar}},
+			Rows:    [][]interface{}{{"a"}},
+		},
+	})
+
+	db, err := sql.Open("dm", srv.DSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var name string
+	count := int64(7)
+	sets, err := CallProcedure(context.Background(), loging.NewStd(), db, "get_user",
+		[]interface{}{1}, []interface{}{&name, sql.Out{Dest: &count, In: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "tom" || count != 8 {
+		t.Fatalf("out = %q, %d", name, count)
+	}
+	want := [][]map[string]interface{}{
+		{{"ID": int32(1)}, {"ID": int32(2)}},
+		{{"NAME": "a"}},
+	}
+	if !reflect.DeepEqual(sets, want) {
+		t.Fatalf("sets = %v", sets)
+	}
+	q := srv.Queries()
+	if len(q) != 1 || !reflect.DeepEqual(q[0].Args, [][]interface{}{{int64(1), nil, int64(7)}}) {
+		t.Fatalf("queries = %#v", q[0].Args)
+	}
+}
+
+func TestCallProcedureNullOut(t *testing.T) {
+	srv, err := dmtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	const call = "CALL get_name(?, ?)"
+	srv.SetParams(call,
+		dmtest.Param{Type: dmtest.Int},
+		dmtest.Param{Type: dmtest.Varchar, IO: dmtest.ParamOut},
+	)
+	srv.Handle(call, &dmtest.Result{Out: []interface{}{"tom"}})
+
+	db, err := sql.Open("dm", srv.DSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	// 可空的 OUT 参数按普通参数接收, 不作为对象类型
+	var name sql.NullString
+	if _, err = CallProcedure(context.Background(), loging.NewStd(), db, "get_name",
+		[]interface{}{1}, []interface{}{&name}); err != nil {
+		t.Fatal(err)
+	}
+	if !name.Valid || name.String != "tom" {
+		t.Fatalf("out = %+v", name)
+	}
+}
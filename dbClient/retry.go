@@ -0,0 +1,80 @@
+package dbClient
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jifuy/commongo/dbClient/dm"
+	"github.com/jifuy/commongo/loging"
+)
+
+// mysql 可重试的错误码
+var mysqlRetryCodes = map[uint16]bool{
+	1205: true, // Lock wait timeout exceeded
+	1213: true, // Deadlock found when trying to get lock
+}
+
+// IsRetryable 判断数据库错误是重试还是直接失败
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) {
+		return true
+	}
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		return mysqlRetryCodes[myErr.Number]
+	}
+	return dm.IsRetryable(err)
+}
+
+// IsUniqueViolation 判断是否违反唯一性约束
+func IsUniqueViolation(err error) bool {
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		return myErr.Number == 1062
+	}
+	return errors.Is(err, dm.ErrUniqueViolation)
+}
+
+// txRetryInterval 事务第一次重试前的等待时间, 之后每次翻倍
+var txRetryInterval = 100 * time.Millisecond
+
+// Transaction 在事务中执行 f, f 返回 nil 时提交, 否则回滚.
+// 死锁、锁超时、连接断开等 IsRetryable 的错误回滚后重新执行整个事务, 最多重试 retries 次
+func Transaction(ctx context.Context, logging loging.Logger, SqlDb *sql.DB, retries int, f func(tx *sql.Tx) error) error {
+	wait := txRetryInterval
+	for i := 0; ; i++ {
+		err := runTx(ctx, SqlDb, f)
+		if err == nil || !IsRetryable(err) || i >= retries {
+			if err != nil {
+				logging.Error("[Sql] Transaction Error : " + err.Error())
+			}
+			return err
+		}
+		logging.Warnf("[Sql] Transaction retry %d/%d : %v", i+1, retries, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+func runTx(ctx context.Context, SqlDb *sql.DB, f func(tx *sql.Tx) error) error {
+	tx, err := SqlDb.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err = f(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
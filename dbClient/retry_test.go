@@ -0,0 +1,100 @@
+package dbClient
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jifuy/commongo/dbClient/dm"
+	"github.com/jifuy/commongo/dbClient/dm/dmtest"
+	"github.com/jifuy/commongo/loging"
+)
+
+func TestIsRetryable(t *testing.T) {
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{errors.New("other"), false},
+		{driver.ErrBadConn, true},
+		{fmt.Errorf("wrap: %w", &mysql.MySQLError{Number: 1213}), true},
+		{&mysql.MySQLError{Number: 1062}, false},
+		{&dm.DmError{ErrCode: -6403}, true},
+		{&dm.DmError{ErrCode: -6602}, false},
+		{dm.ECGO_COMMUNITION_ERROR, true},
+	}
+	for _, c := range cases {
+		if got := IsRetryable(c.err); got != c.want {
+			t.Errorf("IsRetryable(%v) = %v, want %v", c.err, got, c.want)
+		}
+	}
+	if !errors.Is(&dm.DmError{ErrCode: -6602}, dm.ErrUniqueViolation) {
+		t.Error("DmError -6602 should be ErrUniqueViolation")
+	}
+	if !IsUniqueViolation(&mysql.MySQLError{Number: 1062}) {
+		t.Error("MySQLError 1062 should be unique violation")
+	}
+}
+
+func TestTransactionRetry(t *testing.T) {
+	txRetryInterval = 0
+	srv, err := dmtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	// 第一次更新遇到死锁, 回滚后重试成功; 唯一约束冲突不重试
+	deadlocks := 1
+	srv.HandleFunc(func(q *dmtest.Query) *dmtest.Result {
+		switch q.SQL {
+		case "UPDATE t SET n = n + 1":
+			if deadlocks > 0 {
+				deadlocks--
+				return dmtest.Errorf(-6403, "deadlock")
+			}
+		case "INSERT INTO t VALUES(1)":
+			return dmtest.Errorf(-6602, "violate unique constraint")
+		}
+		return &dmtest.Result{Affected: 1}
+	})
+	db, err := sql.Open("dm", srv.DSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var calls int
+	err = Transaction(context.Background(), loging.NewStd(), db, 3, func(tx *sql.Tx) error {
+		calls++
+		_, err := tx.Exec("UPDATE t SET n = n + 1")
+		return err
+	})
+	if err != nil || calls != 2 {
+		t.Fatalf("calls = %d, err = %v", calls, err)
+	}
+
+	calls = 0
+	err = Transaction(context.Background(), loging.NewStd(), db, 3, func(tx *sql.Tx) error {
+		calls++
+		_, err := tx.Exec("INSERT INTO t VALUES(1)")
+		return err
+	})
+	if !IsUniqueViolation(err) || calls != 1 {
+		t.Fatalf("calls = %d, err = %v", calls, err)
+	}
+
+	var tx []string
+	for _, q := range srv.Queries() {
+		if q.SQL == "COMMIT" || q.SQL == "ROLLBACK" {
+			tx = append(tx, q.SQL)
+		}
+	}
+	if fmt.Sprint(tx) != "[ROLLBACK COMMIT ROLLBACK]" {
+		t.Fatalf("transactions = %v", tx)
+	}
+}
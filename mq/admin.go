@@ -0,0 +1,76 @@
+package mq
+
+import (
+	"context"
+	"fmt"
+	"github.com/jifuy/commongo/mq/kafka"
+	"github.com/jifuy/commongo/mq/memory"
+	"github.com/jifuy/commongo/mq/model"
+	"github.com/jifuy/commongo/mq/rocket"
+	"time"
+)
+
+// IAdmin topic 和消费组管理, broker 不支持的操作返回 model.ErrUnsupported
+type IAdmin interface {
+	// CreateTopic 创建 topic, 部署前调用, 避免 kafka 自动创建单分区 topic
+	CreateTopic(ctx context.Context, spec model.TopicSpec) error
+	DeleteTopic(ctx context.Context, name string) error
+	DescribeTopic(ctx context.Context, name string) (model.TopicSpec, error)
+	// SetPartitions 增加分区数, 已有 key 的分区映射会改变
+	SetPartitions(ctx context.Context, name string, count int32) error
+	SetRetention(ctx context.Context, name string, retention time.Duration) error
+	ListGroups(ctx context.Context) ([]string, error)
+	GroupLag(ctx context.Context, group string) ([]model.PartitionLag, error)
+}
+
+// NewAdminMQ 实例化管理接口, rabbit 暂不支持
+func NewAdminMQ(mqChg MqCfg) (IAdmin, func() error, error) {
+	switch mqChg.MqType {
+	case "kafka":
+		var config = kafka.Config{
+			Version: mqChg.Kafka.Version,
+			Brokers: mqChg.Kafka.Brokers,
+
+			SaslEnable: mqChg.Kafka.SaslEnable,
+			Algorithm:  mqChg.Kafka.Algorithm,
+			UserName:   mqChg.Kafka.UserName,
+			PassWord:   mqChg.Kafka.PassWord,
+
+			Realm:              mqChg.Kafka.Realm,
+			ServiceName:        mqChg.Kafka.ServiceName,
+			KeyTabPath:         mqChg.Kafka.KeyTabPath,
+			KerberosConfigPath: mqChg.Kafka.KerberosConfigPath,
+
+			UseTLS:    mqChg.Kafka.UseTLS,
+			VerifySSL: mqChg.Kafka.VerifySSL,
+			CertFile:  mqChg.Kafka.CertFile,
+			KeyFile:   mqChg.Kafka.KeyFile,
+			CaFile:    mqChg.Kafka.CaFile,
+		}
+		if err := config.InitSarama(); err != nil {
+			return nil, nil, err
+		}
+		a, closeFn, err := kafka.NewKafkaAdmin(config)
+		if err != nil {
+			// 不能返回包装了空指针的非空接口
+			return nil, nil, err
+		}
+		return a, closeFn, nil
+	case "rocket":
+		var config = rocket.Config{
+			Brokers:    mqChg.RocketMq.Brokers,
+			UserName:   mqChg.RocketMq.UserName,
+			PassWord:   mqChg.RocketMq.PassWord,
+			BrokerAddr: mqChg.RocketMq.BrokerAddr,
+		}
+		a, closeFn, err := rocket.NewRocketAdmin(config)
+		if err != nil {
+			return nil, nil, err
+		}
+		return a, closeFn, nil
+	case "memory":
+		return memory.NewMemoryAdmin(mqChg.Memory.config())
+	default:
+		return nil, nil, fmt.Errorf("mq type error %s", mqChg.MqType)
+	}
+}
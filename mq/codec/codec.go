@@ -0,0 +1,154 @@
+package codec
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"github.com/golang/snappy"
+	"github.com/linkedin/goavro/v2"
+	"google.golang.org/protobuf/proto"
+	"io"
+	"reflect"
+)
+
+// 内容类型, 写入消息头 content-type
+const (
+	ContentTypeJSON  = "application/json"
+	ContentTypeProto = "application/x-protobuf"
+	ContentTypeAvro  = "avro/binary"
+)
+
+// 压缩算法, 写入消息头 content-encoding
+const (
+	Gzip   = "gzip"
+	Snappy = "snappy"
+)
+
+// Codec 消息体的编解码
+type Codec interface {
+	ContentType() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(b []byte, v interface{}) error
+}
+
+// JSON 使用 encoding/json 编解码
+type JSON struct{}
+
+func (JSON) ContentType() string                     { return ContentTypeJSON }
+func (JSON) Marshal(v interface{}) ([]byte, error)   { return json.Marshal(v) }
+func (JSON) Unmarshal(b []byte, v interface{}) error { return json.Unmarshal(b, v) }
+
+// Proto 编解码 protobuf 消息, 类型参数为生成的消息指针, 例如 *pb.Alarm
+type Proto struct{}
+
+func (Proto) ContentType() string { return ContentTypeProto }
+
+func (Proto) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("codec: %T is not a proto.Message", v)
+	}
+	return proto.Marshal(m)
+}
+
+// Unmarshal v 为 proto.Message 或指向 proto.Message 指针的指针, 后者为空时分配新消息
+func (Proto) Unmarshal(b []byte, v interface{}) error {
+	if m, ok := v.(proto.Message); ok {
+		return proto.Unmarshal(b, m)
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Ptr {
+		return fmt.Errorf("codec: %T is not a proto.Message", v)
+	}
+	if rv.Elem().IsNil() {
+		rv.Elem().Set(reflect.New(rv.Elem().Type().Elem()))
+	}
+	m, ok := rv.Elem().Interface().(proto.Message)
+	if !ok {
+		return fmt.Errorf("codec: %T is not a proto.Message", v)
+	}
+	return proto.Unmarshal(b, m)
+}
+
+// Avro 按 schema 编解码 avro 二进制, Go 值经由标准 JSON 转换, 字段按 json tag 对应 avro 字段
+type Avro struct {
+	codec *goavro.Codec
+}
+
+// NewAvro schema 为 avro schema 的 JSON 文本
+func NewAvro(schema string) (*Avro, error) {
+	c, err := goavro.NewCodecForStandardJSONFull(schema)
+	if err != nil {
+		return nil, err
+	}
+	return &Avro{codec: c}, nil
+}
+
+func (a *Avro) ContentType() string { return ContentTypeAvro }
+
+func (a *Avro) Marshal(v interface{}) ([]byte, error) {
+	text, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	native, _, err := a.codec.NativeFromTextual(text)
+	if err != nil {
+		return nil, err
+	}
+	return a.codec.BinaryFromNative(nil, native)
+}
+
+func (a *Avro) Unmarshal(b []byte, v interface{}) error {
+	native, rest, err := a.codec.NativeFromBinary(b)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return fmt.Errorf("codec: %d trailing bytes after avro datum", len(rest))
+	}
+	text, err := a.codec.TextualFromNative(nil, native)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(text, v)
+}
+
+// Compress 按 encoding 压缩, 为空时原样返回
+func Compress(encoding string, b []byte) ([]byte, error) {
+	switch encoding {
+	case "":
+		return b, nil
+	case Gzip:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(b); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case Snappy:
+		return snappy.Encode(nil, b), nil
+	}
+	return nil, fmt.Errorf("codec: unknown content encoding %q", encoding)
+}
+
+// Decompress 按 encoding 解压, 为空时原样返回
+func Decompress(encoding string, b []byte) ([]byte, error) {
+	switch encoding {
+	case "":
+		return b, nil
+	case Gzip:
+		r, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	case Snappy:
+		return snappy.Decode(nil, b)
+	}
+	return nil, fmt.Errorf("codec: unknown content encoding %q", encoding)
+}
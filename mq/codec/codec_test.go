@@ -0,0 +1,82 @@
+package codec
+
+import (
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"testing"
+)
+
+type alarm struct {
+	AlarmID string `json:"alarmId"`
+	Level   int    `json:"level"`
+}
+
+const alarmAvro = `{"type": "record", "name": "Alarm", "fields": [
+	{"name": "alarmId", "type": "string"}, {"name": "level", "type": "int"}]}`
+
+func TestCodecs(t *testing.T) {
+	avro, err := NewAvro(alarmAvro)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []Codec{JSON{}, avro} {
+		for _, enc := range []string{"", Gzip, Snappy} {
+			b, err := c.Marshal(alarm{AlarmID: "a1", Level: 3})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b, err = Compress(enc, b); err != nil {
+				t.Fatal(err)
+			}
+			if b, err = Decompress(enc, b); err != nil {
+				t.Fatal(err)
+			}
+			var got alarm
+			if err = c.Unmarshal(b, &got); err != nil {
+				t.Fatal(err)
+			}
+			if got != (alarm{AlarmID: "a1", Level: 3}) {
+				t.Fatalf("%s/%s got %+v", c.ContentType(), enc, got)
+			}
+		}
+	}
+
+	b, err := Proto{}.Marshal(wrapperspb.String("a1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got *wrapperspb.StringValue
+	if err = (Proto{}).Unmarshal(b, &got); err != nil || got.GetValue() != "a1" {
+		t.Fatalf("proto got %v, err %v", got, err)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	r, err := ParseRegistry([]byte(`{
+		"unios-alarm-std": {"type": "json", "schema": {"type": "object", "required": ["alarmId"],
+			"properties": {"level": {"type": "integer", "maximum": 5}}}},
+		"unios-alarm-avro": {"type": "avro", "schema": ` + alarmAvro + `}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	avro, _ := NewAvro(alarmAvro)
+	valid, _ := avro.Marshal(alarm{AlarmID: "a1", Level: 3})
+	cases := []struct {
+		subject string
+		b       string
+		ok      bool
+	}{
+		{"unios-alarm-std", `{"alarmId": "a1", "level": 3}`, true},
+		{"unios-alarm-std", `{"level": 3}`, false},
+		{"unios-alarm-std", `{"alarmId": "a1", "level": 9}`, false},
+		{"unios-alarm-std", `not json`, false},
+		{"unios-alarm-avro", string(valid), true},
+		{"unios-alarm-avro", string(valid[:2]), false},
+		{"other", `anything`, true},
+	}
+	for _, c := range cases {
+		if err := r.Validate(c.subject, []byte(c.b)); (err == nil) != c.ok {
+			t.Errorf("Validate(%s, %q) = %v, want ok %v", c.subject, c.b, err, c.ok)
+		}
+	}
+}
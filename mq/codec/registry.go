@@ -0,0 +1,100 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/linkedin/goavro/v2"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"os"
+)
+
+// Registry 本地 schema 注册表, 按 subject(一般为 topic) 校验消息体. 文件格式:
+//
+//	{
+//	  "unios-alarm-std": {"type": "json", "schema": {"type": "object", "required": ["alarmId"]}},
+//	  "unios-alarm-avro": {"type": "avro", "schema": {"type": "record", "name": "Alarm", "fields": [...]}}
+//	}
+type Registry struct {
+	subjects map[string]validator
+}
+
+type validator func(b []byte) error
+
+type entry struct {
+	Type   string          `json:"type"` // json/avro
+	Schema json.RawMessage `json:"schema"`
+}
+
+// LoadRegistry 读取注册表文件并编译全部 schema
+func LoadRegistry(path string) (*Registry, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseRegistry(b)
+}
+
+// ParseRegistry 解析注册表内容并编译全部 schema
+func ParseRegistry(b []byte) (*Registry, error) {
+	var entries map[string]entry
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return nil, err
+	}
+	r := &Registry{subjects: make(map[string]validator, len(entries))}
+	for subject, e := range entries {
+		v, err := compile(subject, e)
+		if err != nil {
+			return nil, fmt.Errorf("codec: schema of %s: %w", subject, err)
+		}
+		r.subjects[subject] = v
+	}
+	return r, nil
+}
+
+func compile(subject string, e entry) (validator, error) {
+	switch e.Type {
+	case "json":
+		s, err := jsonschema.CompileString(subject+".json", string(e.Schema))
+		if err != nil {
+			return nil, err
+		}
+		return func(b []byte) error {
+			d := json.NewDecoder(bytes.NewReader(b))
+			d.UseNumber()
+			var v interface{}
+			if err := d.Decode(&v); err != nil {
+				return err
+			}
+			return s.Validate(v)
+		}, nil
+	case "avro":
+		c, err := goavro.NewCodec(string(e.Schema))
+		if err != nil {
+			return nil, err
+		}
+		return func(b []byte) error {
+			_, rest, err := c.NativeFromBinary(b)
+			if err == nil && len(rest) > 0 {
+				err = fmt.Errorf("%d trailing bytes after avro datum", len(rest))
+			}
+			return err
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown schema type %q", e.Type)
+}
+
+// Validate 校验未压缩的消息体, subject 没有注册 schema 时不校验
+func (r *Registry) Validate(subject string, b []byte) error {
+	if r == nil {
+		return nil
+	}
+	v, ok := r.subjects[subject]
+	if !ok {
+		return nil
+	}
+	if err := v(b); err != nil {
+		return fmt.Errorf("codec: %s does not match schema: %w", subject, err)
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package mq
+
+import (
+	"github.com/jifuy/commongo/loging"
+	"github.com/jifuy/commongo/mq/metrics"
+	"github.com/jifuy/commongo/mq/model"
+	"github.com/jifuy/commongo/redisClient"
+	"github.com/jifuy/commongo/safemap"
+	"github.com/tidwall/gjson"
+	"sync"
+	"time"
+)
+
+// DedupStatus Claim 的结果
+type DedupStatus int
+
+const (
+	DedupClaimed    DedupStatus = iota // 写入成功, 由本次回调处理
+	DedupProcessing                    // 其他回调正在处理, 尚未提交
+	DedupCommitted                     // 已处理并提交
+)
+
+// DedupStore 记录处理中和已处理的消息, 实现必须并发安全
+type DedupStore interface {
+	// Claim key 不存在时标记为处理中并在 ttl 后过期, 已存在时返回它的状态
+	Claim(key string, ttl time.Duration) (DedupStatus, error)
+	// Commit 回调成功后把 key 标记为已处理, 保留 ttl
+	Commit(key string, ttl time.Duration) error
+	// Release 回调失败后删除处理中的 key, 重新投递的消息可以再次处理
+	Release(key string) error
+}
+
+// DedupCfg 消费去重的配置
+type DedupCfg struct {
+	Group            string          // 去重的命名空间, 一般为消费组, 不同消费组互不影响
+	Header           string          // 消息 id 所在的消息头, 为空时使用 ConsumerMsg.MessageID
+	Path             string          // 消息 id 在 JSON 消息体中的路径(gjson 语法), 例如 alarm.id, 优先于 Header
+	TTLSecond        int             // 已处理消息的保留时间, 默认 86400
+	ProcessingSecond int             // 处理中消息的保留时间, 进程在回调中退出时超过该时间后可以再次处理, 默认 300
+	Metrics          metrics.Metrics // 实现 metrics.DuplicateRecorder 时记录跳过的重复消息
+}
+
+// WithDedup 包装消费回调: 同一消费组在 TTL 内已处理的消息直接确认, 不进入回调;
+// 正在处理的消息返回 false, 等重新投递时按处理结果决定. 取不到消息 id 或 store 出错时照常回调
+func WithDedup(cfg DedupCfg, store DedupStore, f func(b model.ConsumerMsg) bool) func(b model.ConsumerMsg) bool {
+	ttl := time.Duration(cfg.TTLSecond) * time.Second
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+	processing := time.Duration(cfg.ProcessingSecond) * time.Second
+	if processing <= 0 {
+		processing = 5 * time.Minute
+	}
+	dup, _ := cfg.Metrics.(metrics.DuplicateRecorder)
+	return func(b model.ConsumerMsg) bool {
+		id := messageID(cfg, b)
+		if id == "" {
+			return f(b)
+		}
+		key := cfg.Group + ":" + b.Topic + ":" + id
+		status, err := store.Claim(key, processing)
+		if err != nil {
+			loging.Errorf("dedup claim %s failed: %v", key, err)
+			return f(b)
+		}
+		switch status {
+		case DedupCommitted:
+			if dup != nil {
+				dup.Duplicate(b.Topic, cfg.Group)
+			}
+			loging.Debugf("skip duplicate message %s, partition:%d, offset:%d", id, b.Partition, b.Offset)
+			return true
+		case DedupProcessing:
+			// 第一次处理可能失败, 不能确认
+			loging.Debugf("message %s is being processed, partition:%d, offset:%d", id, b.Partition, b.Offset)
+			return false
+		}
+		ok := false
+		defer func() {
+			if !ok {
+				// 回调失败或 panic
+				if err := store.Release(key); err != nil {
+					loging.Errorf("dedup release %s failed: %v", key, err)
+				}
+			}
+		}()
+		if ok = f(b); ok {
+			if err := store.Commit(key, ttl); err != nil {
+				loging.Errorf("dedup commit %s failed: %v", key, err)
+			}
+		}
+		return ok
+	}
+}
+
+func messageID(cfg DedupCfg, b model.ConsumerMsg) string {
+	if cfg.Path != "" {
+		return gjson.GetBytes(b.Value, cfg.Path).String()
+	}
+	if cfg.Header != "" {
+		return b.Headers[cfg.Header]
+	}
+	return b.MessageID
+}
+
+// RedisDedup 使用 redis 去重, 多个实例共享. 处理中和已提交的 key 使用不同的值
+type RedisDedup struct {
+	r      *redisClient.RedisInfo
+	prefix string
+}
+
+// NewRedisDedup prefix 为 key 前缀, 为空时使用 mq:dedup:
+func NewRedisDedup(r *redisClient.RedisInfo, prefix string) *RedisDedup {
+	if prefix == "" {
+		prefix = "mq:dedup:"
+	}
+	return &RedisDedup{r: r, prefix: prefix}
+}
+
+const (
+	dedupProcessing = "processing"
+	dedupCommitted  = "committed"
+)
+
+// dedupClaimScript key 不存在时写入处理中并返回空串, 否则返回当前值
+const dedupClaimScript = `if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'EX', ARGV[2]) then return '' end
+return redis.call('GET', KEYS[1]) or ''`
+
+// dedupReleaseScript 只删除处理中的 key, 不影响已提交的记录
+const dedupReleaseScript = `if redis.call('GET', KEYS[1]) == ARGV[1] then return redis.call('DEL', KEYS[1]) end
+return 0`
+
+func (d *RedisDedup) Claim(key string, ttl time.Duration) (DedupStatus, error) {
+	reply, err := d.r.Eval(dedupClaimScript, []string{d.prefix + key}, dedupProcessing, seconds(ttl))
+	if err != nil {
+		return DedupClaimed, err
+	}
+	v, _ := reply.([]byte)
+	switch string(v) {
+	case "":
+		return DedupClaimed, nil
+	case dedupCommitted:
+		return DedupCommitted, nil
+	default:
+		return DedupProcessing, nil
+	}
+}
+
+// Commit 覆盖为已提交并重新设置过期时间, 处理中的 key 已过期时也能写入
+func (d *RedisDedup) Commit(key string, ttl time.Duration) error {
+	return d.r.SetEX(d.prefix+key, dedupCommitted, seconds(ttl))
+}
+
+func (d *RedisDedup) Release(key string) error {
+	_, err := d.r.Eval(dedupReleaseScript, []string{d.prefix + key}, dedupProcessing)
+	return err
+}
+
+func seconds(d time.Duration) int {
+	if s := int(d / time.Second); s > 0 {
+		return s
+	}
+	return 1
+}
+
+// MemoryDedup 进程内去重, 只对本进程收到的消息有效, 过期记录在写入时定期清理
+type MemoryDedup struct {
+	mu     sync.Mutex
+	m      *safemap.SafeMap[string, dedupEntry]
+	purged time.Time
+}
+
+type dedupEntry struct {
+	expire    time.Time
+	committed bool
+}
+
+func NewMemoryDedup() *MemoryDedup {
+	return &MemoryDedup{m: safemap.NewSafeMap[string, dedupEntry](), purged: time.Now()}
+}
+
+func (d *MemoryDedup) Claim(key string, ttl time.Duration) (DedupStatus, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	if now.Sub(d.purged) > time.Minute {
+		d.purge(now)
+	}
+	if e, ok := d.m.Get(key); ok && e.expire.After(now) {
+		if e.committed {
+			return DedupCommitted, nil
+		}
+		return DedupProcessing, nil
+	}
+	d.m.Set(key, dedupEntry{expire: now.Add(ttl)})
+	return DedupClaimed, nil
+}
+
+func (d *MemoryDedup) Commit(key string, ttl time.Duration) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.m.Set(key, dedupEntry{expire: time.Now().Add(ttl), committed: true})
+	return nil
+}
+
+func (d *MemoryDedup) Release(key string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if e, ok := d.m.Get(key); ok && !e.committed {
+		d.m.Del(key)
+	}
+	return nil
+}
+
+// purge 删除过期记录, 调用方持有 d.mu
+func (d *MemoryDedup) purge(now time.Time) {
+	var expired []string
+	d.m.Range(func(key string, e dedupEntry) bool {
+		if !e.expire.After(now) {
+			expired = append(expired, key)
+		}
+		return true
+	})
+	for _, key := range expired {
+		d.m.Del(key)
+	}
+	d.purged = now
+}
@@ -0,0 +1,156 @@
+package kafka
+
+import (
+	"context"
+	"github.com/IBM/sarama"
+	"github.com/jifuy/commongo/mq/model"
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const configRetention = "retention.ms"
+
+// MQKafkaAdmin Kafka topic 和消费组管理
+type MQKafkaAdmin struct {
+	A      sarama.ClusterAdmin
+	client sarama.Client
+}
+
+func NewKafkaAdmin(config Config) (*MQKafkaAdmin, func() error, error) {
+	client, err := sarama.NewClient(strings.Split(config.Brokers, ","), config.saram)
+	if err != nil {
+		return nil, nil, err
+	}
+	admin, err := sarama.NewClusterAdminFromClient(client)
+	if err != nil {
+		client.Close()
+		return nil, nil, err
+	}
+	// 关闭 admin 时一并关闭 client
+	return &MQKafkaAdmin{A: admin, client: client}, admin.Close, nil
+}
+
+// CreateTopic 创建 topic, 已存在时返回错误
+func (m *MQKafkaAdmin) CreateTopic(_ context.Context, spec model.TopicSpec) error {
+	detail := &sarama.TopicDetail{NumPartitions: spec.Partitions, ReplicationFactor: spec.Replication}
+	if detail.NumPartitions <= 0 {
+		detail.NumPartitions = 1
+	}
+	if detail.ReplicationFactor <= 0 {
+		detail.ReplicationFactor = 1
+	}
+	if len(spec.Configs) > 0 || spec.Retention > 0 {
+		detail.ConfigEntries = make(map[string]*string, len(spec.Configs)+1)
+		for k, v := range spec.Configs {
+			v := v
+			detail.ConfigEntries[k] = &v
+		}
+		if spec.Retention > 0 {
+			v := strconv.FormatInt(spec.Retention.Milliseconds(), 10)
+			detail.ConfigEntries[configRetention] = &v
+		}
+	}
+	return m.A.CreateTopic(spec.Name, detail, false)
+}
+
+func (m *MQKafkaAdmin) DeleteTopic(_ context.Context, name string) error {
+	return m.A.DeleteTopic(name)
+}
+
+// DescribeTopic 查询分区数、副本数和非默认配置
+func (m *MQKafkaAdmin) DescribeTopic(_ context.Context, name string) (model.TopicSpec, error) {
+	metas, err := m.A.DescribeTopics([]string{name})
+	if err != nil {
+		return model.TopicSpec{}, err
+	}
+	if len(metas) == 0 {
+		return model.TopicSpec{}, sarama.ErrUnknownTopicOrPartition
+	}
+	if metas[0].Err != sarama.ErrNoError {
+		return model.TopicSpec{}, metas[0].Err
+	}
+	spec := model.TopicSpec{Name: name, Partitions: int32(len(metas[0].Partitions))}
+	if len(metas[0].Partitions) > 0 {
+		spec.Replication = int16(len(metas[0].Partitions[0].Replicas))
+	}
+	entries, err := m.A.DescribeConfig(sarama.ConfigResource{Type: sarama.TopicResource, Name: name})
+	if err != nil {
+		return model.TopicSpec{}, err
+	}
+	for _, e := range entries {
+		if e.Default || e.Source == sarama.SourceDefault || e.Source == sarama.SourceStaticBroker {
+			continue
+		}
+		if spec.Configs == nil {
+			spec.Configs = make(map[string]string)
+		}
+		spec.Configs[e.Name] = e.Value
+		if e.Name == configRetention {
+			if ms, err := strconv.ParseInt(e.Value, 10, 64); err == nil && ms > 0 {
+				spec.Retention = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+	return spec, nil
+}
+
+// SetPartitions 增加分区数, 不能减少
+func (m *MQKafkaAdmin) SetPartitions(_ context.Context, name string, count int32) error {
+	return m.A.CreatePartitions(name, count, nil, false)
+}
+
+// SetRetention 修改消息保留时间, 不影响其他配置
+func (m *MQKafkaAdmin) SetRetention(_ context.Context, name string, retention time.Duration) error {
+	v := strconv.FormatInt(retention.Milliseconds(), 10)
+	return m.A.IncrementalAlterConfig(sarama.TopicResource, name, map[string]sarama.IncrementalAlterConfigsEntry{
+		configRetention: {Operation: sarama.IncrementalAlterConfigsOperationSet, Value: &v},
+	}, false)
+}
+
+func (m *MQKafkaAdmin) ListGroups(_ context.Context) ([]string, error) {
+	groups, err := m.A.ListConsumerGroups()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// GroupLag 查询消费组在已提交偏移量的各分区上的积压
+func (m *MQKafkaAdmin) GroupLag(_ context.Context, group string) ([]model.PartitionLag, error) {
+	resp, err := m.A.ListConsumerGroupOffsets(group, nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Err != sarama.ErrNoError {
+		return nil, resp.Err
+	}
+	var lags []model.PartitionLag
+	for topic, blocks := range resp.Blocks {
+		for partition, block := range blocks {
+			if block.Err != sarama.ErrNoError {
+				return nil, errors.Wrapf(block.Err, "fetch offset of %s-%d", topic, partition)
+			}
+			end, err := m.client.GetOffset(topic, partition, sarama.OffsetNewest)
+			if err != nil {
+				return nil, err
+			}
+			lag := model.PartitionLag{Topic: topic, Partition: partition, Committed: block.Offset, End: end, Lag: end - block.Offset}
+			if block.Offset < 0 {
+				// 没有提交过, 积压为分区内全部消息
+				oldest, err := m.client.GetOffset(topic, partition, sarama.OffsetOldest)
+				if err != nil {
+					return nil, err
+				}
+				lag.Lag = end - oldest
+			}
+			lags = append(lags, lag)
+		}
+	}
+	return lags, nil
+}
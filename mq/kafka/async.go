@@ -0,0 +1,167 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"github.com/IBM/sarama"
+	"github.com/jifuy/commongo/loging"
+	"github.com/jifuy/commongo/mq/metrics"
+	"github.com/jifuy/commongo/mq/model"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrProducerClosed = errors.New("kafka: producer closed")
+
+// DeliveryResult 异步发送的投递结果, Err 为空表示 broker 已确认
+type DeliveryResult struct {
+	Topic     string
+	Key       string
+	Value     []byte
+	Partition int32
+	Offset    int64
+	Err       error
+}
+
+// MQKafkaAsync 异步批量发送的 Kafka 生产者, 消息按 Linger/BatchSize 攒批发送, 投递结果通过 OnDelivery 或 DeliveryChan 返回
+type MQKafkaAsync struct {
+	P      sarama.AsyncProducer
+	Config Config
+
+	sendMu sync.RWMutex // 关闭时等待正在写入 Input 的发送
+	closed bool
+
+	mu       sync.Mutex
+	inflight int64
+	idle     chan struct{} // inflight 归零时关闭
+
+	done chan struct{}
+}
+
+func NewKafkaAsyncProducer(config Config) (*MQKafkaAsync, func() error, error) {
+	client, err := sarama.NewAsyncProducer(strings.Split(config.Brokers, ","), config.saram)
+	if err != nil {
+		return nil, nil, err
+	}
+	m := newKafkaAsync(client, config)
+	return m, m.Close, nil
+}
+
+func newKafkaAsync(p sarama.AsyncProducer, config Config) *MQKafkaAsync {
+	m := &MQKafkaAsync{P: p, Config: config, idle: make(chan struct{}), done: make(chan struct{})}
+	close(m.idle)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for msg := range p.Successes() {
+			m.deliver(msg, nil)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for e := range p.Errors() {
+			m.deliver(e.Msg, e.Err)
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(m.done)
+	}()
+	return m
+}
+
+// Producer 生产者 消息写入发送缓冲即返回, 缓冲满时阻塞; 发送结果见 Config.OnDelivery
+func (m *MQKafkaAsync) Producer(topic string, key, _ string, data []byte) error {
+	return m.SendMessage(context.Background(), &model.Message{Topic: topic, Key: key, Value: data})
+}
+
+// SendMessage 发送带记录头的消息, 缓冲满时阻塞到 ctx 结束
+func (m *MQKafkaAsync) SendMessage(ctx context.Context, message *model.Message) error {
+	msg := toProducerMessage(message)
+	msg.Metadata = time.Now() // 投递时计算发送耗时
+
+	m.sendMu.RLock()
+	defer m.sendMu.RUnlock()
+	if m.closed {
+		return ErrProducerClosed
+	}
+	m.mu.Lock()
+	if m.inflight == 0 {
+		m.idle = make(chan struct{})
+	}
+	m.inflight++
+	m.mu.Unlock()
+	select {
+	case m.P.Input() <- msg:
+		return nil
+	case <-ctx.Done():
+		m.finish()
+		return ctx.Err()
+	}
+}
+
+// Flush 等待已发送的消息全部得到确认或失败, ctx 结束时返回 ctx.Err()
+func (m *MQKafkaAsync) Flush(ctx context.Context) error {
+	m.mu.Lock()
+	idle := m.idle
+	m.mu.Unlock()
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close 停止接收新消息, 发送完缓冲中的消息后关闭
+func (m *MQKafkaAsync) Close() error {
+	m.sendMu.Lock()
+	if m.closed {
+		m.sendMu.Unlock()
+		return nil
+	}
+	m.closed = true
+	m.sendMu.Unlock()
+
+	// 不用 Close, 它会和投递协程争抢 Errors 中的结果
+	m.P.AsyncClose()
+	<-m.done
+	return nil
+}
+
+func (m *MQKafkaAsync) deliver(msg *sarama.ProducerMessage, err error) {
+	r := DeliveryResult{Topic: msg.Topic, Partition: msg.Partition, Offset: msg.Offset, Err: err}
+	if msg.Key != nil {
+		if b, e := msg.Key.Encode(); e == nil {
+			r.Key = string(b)
+		}
+	}
+	if msg.Value != nil {
+		r.Value, _ = msg.Value.Encode()
+	}
+	if start, ok := msg.Metadata.(time.Time); ok {
+		metrics.OrNop(m.Config.Metrics).Sent(msg.Topic, time.Since(start), err)
+	}
+	if err != nil && m.Config.OnDelivery == nil && m.Config.DeliveryChan == nil {
+		loging.Errorf("send msg failed, topic:%s, key:%s, err:%v", r.Topic, r.Key, err)
+	}
+	if m.Config.OnDelivery != nil {
+		m.Config.OnDelivery(r)
+	}
+	if m.Config.DeliveryChan != nil {
+		m.Config.DeliveryChan <- r
+	}
+	m.finish()
+}
+
+func (m *MQKafkaAsync) finish() {
+	m.mu.Lock()
+	m.inflight--
+	if m.inflight == 0 {
+		close(m.idle)
+	}
+	m.mu.Unlock()
+}
@@ -0,0 +1,84 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/jifuy/commongo/mq/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAsyncProducer(t *testing.T) {
+	config := Config{Brokers: "127.0.0.1:9092", Compression: "lz4", Idempotent: true, LingerMilliSecond: 50, BatchSize: 100}
+	if err := config.InitSarama(); err != nil {
+		t.Fatal(err)
+	}
+	if !config.saram.Producer.Idempotent || config.saram.Producer.RequiredAcks != sarama.WaitForAll ||
+		config.saram.Producer.Compression != sarama.CompressionLZ4 || config.saram.Producer.Flush.Messages != 100 {
+		t.Fatalf("producer config not applied: %+v", config.saram.Producer)
+	}
+	if err := (&Config{Acks: "local", Idempotent: true}).InitSarama(); err == nil {
+		t.Fatal("expected error for idempotent with acks local")
+	}
+
+	reg := prometheus.NewRegistry()
+	mt, err := metrics.NewPrometheus("test", reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Metrics = mt
+	var mu sync.Mutex
+	var results []DeliveryResult
+	config.OnDelivery = func(r DeliveryResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		results = append(results, r)
+	}
+	mock := mocks.NewAsyncProducer(t, config.saram)
+	mock.ExpectInputAndSucceed().ExpectInputAndFail(errors.New("broker down")).ExpectInputAndSucceed()
+	p := newKafkaAsync(mock, config)
+	for _, key := range []string{"a", "b", "c"} {
+		if err := p.Producer("unios-alarm-std", key, "", []byte("Msg+"+key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := p.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	if len(results) != 3 {
+		t.Fatalf("results = %+v", results)
+	}
+	for _, r := range results {
+		if (r.Key == "b") != (r.Err != nil) || string(r.Value) != "Msg+"+r.Key {
+			t.Fatalf("result %+v", r)
+		}
+	}
+	mu.Unlock()
+	expected := `
+# HELP test_mq_send_failed_total Producer sends that failed.
+# TYPE test_mq_send_failed_total counter
+test_mq_send_failed_total{topic="unios-alarm-std"} 1
+# HELP test_mq_sent_total Messages sent by producers.
+# TYPE test_mq_sent_total counter
+test_mq_sent_total{topic="unios-alarm-std"} 3
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected), "test_mq_sent_total", "test_mq_send_failed_total"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Producer("unios-alarm-std", "", "", nil); err != ErrProducerClosed {
+		t.Fatalf("after close: %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+package kafka
+
+import (
+	"github.com/IBM/sarama"
+	"github.com/jifuy/commongo/loging"
+	"github.com/jifuy/commongo/mq/metrics"
+	"github.com/jifuy/commongo/mq/model"
+	"time"
+)
+
+// batchRetryInterval 批量回调失败后重试同一批消息的间隔
+var batchRetryInterval = time.Second
+
+// ConsumeBatch 批量消费 每个分区攒够 MaxCount 条或等待 MaxWait 后回调一次,
+// 回调返回 nil 才提交这一批的偏移量, 返回错误时间隔后重试同一批; 忽略 group 参数, 消费组使用配置中的 Group
+func (m MQKafkaService) ConsumeBatch(topic, _ string, opts model.BatchOptions, f func(msgs []model.ConsumerMsg) error) (func() error, error) {
+	return m.consume(topic, &batchConsumer{cb: f, opts: opts.WithDefaults(), group: m.Config.Group, metrics: m.Config.Metrics})
+}
+
+type batchConsumer struct {
+	cb   func(msgs []model.ConsumerMsg) error
+	opts model.BatchOptions
+
+	group   string
+	metrics metrics.Metrics
+}
+
+func (c *batchConsumer) Setup(s sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+func (c *batchConsumer) Cleanup(s sarama.ConsumerGroupSession) error {
+	s.Commit()
+	return nil
+}
+
+func (c *batchConsumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	var batch []model.ConsumerMsg
+	var last *sarama.ConsumerMessage
+	var timeout <-chan time.Time
+	mt := metrics.OrNop(c.metrics)
+	// flush 回调直到成功, 会话结束时放弃, 未提交的消息由重新分配后的消费者再次消费
+	flush := func() bool {
+		for {
+			start := time.Now()
+			err := c.cb(batch)
+			// 整批回调的耗时计入每条消息
+			for _, msg := range batch {
+				mt.Consumed(msg.Topic, msg.Partition, time.Since(start), err == nil)
+			}
+			if err == nil {
+				session.MarkMessage(last, "")
+				mt.Lag(last.Topic, c.group, last.Partition, claim.HighWaterMarkOffset()-last.Offset-1)
+				batch, timeout = nil, nil
+				return true
+			}
+			loging.Warnf("Batch callback failed, retrying. Partition:%d, Offset:%d-%d, err:%v", last.Partition, batch[0].Offset, last.Offset, err)
+			select {
+			case <-session.Context().Done():
+				return false
+			case <-time.After(batchRetryInterval):
+			}
+		}
+	}
+
+	for {
+		select {
+		case message, ok := <-claim.Messages():
+			if !ok {
+				if len(batch) > 0 {
+					flush()
+				}
+				return nil
+			}
+			if batch == nil {
+				batch = make([]model.ConsumerMsg, 0, c.opts.MaxCount)
+				timeout = time.After(c.opts.MaxWait)
+			}
+			batch = append(batch, toConsumerMsg(message))
+			last = message
+			if len(batch) >= c.opts.MaxCount && !flush() {
+				return nil
+			}
+		case <-timeout:
+			if !flush() {
+				return nil
+			}
+		case <-session.Context().Done():
+			return nil
+		}
+	}
+}
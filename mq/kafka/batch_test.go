@@ -0,0 +1,81 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"github.com/IBM/sarama"
+	"github.com/jifuy/commongo/mq/model"
+	"testing"
+	"time"
+)
+
+type fakeSession struct {
+	sarama.ConsumerGroupSession
+	ctx    context.Context
+	marked []int64
+}
+
+func (s *fakeSession) Context() context.Context { return s.ctx }
+
+func (s *fakeSession) MarkMessage(msg *sarama.ConsumerMessage, _ string) {
+	s.marked = append(s.marked, msg.Offset)
+}
+
+func (s *fakeSession) MarkOffset(_ string, _ int32, offset int64, _ string) {
+	s.marked = append(s.marked, offset-1)
+}
+
+type fakeClaim struct {
+	sarama.ConsumerGroupClaim
+	msgs chan *sarama.ConsumerMessage
+}
+
+func (c *fakeClaim) Messages() <-chan *sarama.ConsumerMessage { return c.msgs }
+
+func (c *fakeClaim) HighWaterMarkOffset() int64 { return 100 }
+
+func (c *fakeClaim) Topic() string { return "unios-alarm-std" }
+
+func (c *fakeClaim) Partition() int32 { return 0 }
+
+func TestConsumeBatch(t *testing.T) {
+	batchRetryInterval = 10 * time.Millisecond
+	var batches [][]int64
+	fail := true
+	h := &batchConsumer{opts: model.BatchOptions{MaxCount: 3, MaxWait: 50 * time.Millisecond}.WithDefaults()}
+	h.cb = func(msgs []model.ConsumerMsg) error {
+		if fail {
+			fail = false
+			return errors.New("db down")
+		}
+		var offsets []int64
+		for _, m := range msgs {
+			offsets = append(offsets, m.Offset)
+		}
+		batches = append(batches, offsets)
+		return nil
+	}
+
+	session := &fakeSession{ctx: context.Background()}
+	claim := &fakeClaim{msgs: make(chan *sarama.ConsumerMessage, 10)}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.ConsumeClaim(session, claim)
+	}()
+	for i := int64(0); i < 4; i++ {
+		claim.msgs <- &sarama.ConsumerMessage{Topic: "unios-alarm-std", Offset: i, Value: []byte("Msg")}
+	}
+	// 第 4 条等待 MaxWait 后单独成批
+	time.Sleep(200 * time.Millisecond)
+	claim.msgs <- &sarama.ConsumerMessage{Topic: "unios-alarm-std", Offset: 4}
+	close(claim.msgs)
+	<-done
+
+	if len(batches) != 3 || len(batches[0]) != 3 || len(batches[1]) != 1 || batches[2][0] != 4 {
+		t.Fatalf("batches = %v", batches)
+	}
+	if len(session.marked) != 3 || session.marked[0] != 2 || session.marked[1] != 3 || session.marked[2] != 4 {
+		t.Fatalf("marked = %v", session.marked)
+	}
+}
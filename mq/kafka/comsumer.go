@@ -5,7 +5,9 @@ import (
 	"errors"
 	"github.com/IBM/sarama"
 	"github.com/jifuy/commongo/loging"
+	"github.com/jifuy/commongo/mq/metrics"
 	"github.com/jifuy/commongo/mq/model"
+	"io"
 	"strings"
 	"time"
 )
@@ -15,40 +17,58 @@ func NewKafkaCustomer(config Config) (MQKafkaService, func() error, error) {
 		// 1个partition只能被同group的一个consumer消费，随机创建group，多个consumer可以消费同一个topic ,不同为空。随机多个消费组都消费
 		config.Group = NewUUIDStr()
 	}
-	consumerGroup, err := sarama.NewConsumerGroup(strings.Split(config.Brokers, ","), config.Group, config.saram) //同一个消费组话只能被一个人消费 ,这种模式group不能为空
+	brokers := strings.Split(config.Brokers, ",")
+	consumerGroup, err := sarama.NewConsumerGroup(brokers, config.Group, config.saram) //同一个消费组话只能被一个人消费 ,这种模式group不能为空
 	if err != nil {
 		return MQKafkaService{}, nil, err
 	}
-	return MQKafkaService{C: consumerGroup, Config: config},
-		func() error {
-			return consumerGroup.Close()
-		}, nil
+	conn := newLiveClient(consumerGroup, config.Reconnect, func() (io.Closer, error) {
+		c, err := sarama.NewConsumerGroup(brokers, config.Group, config.saram)
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	})
+	m := MQKafkaService{C: consumerGroup, Config: config, subs: &subscriptions{}, conn: conn}
+	return m, m.closeGroup, nil
 }
 
-// Consumer 消费者组 组不相同时都可以消费到,启动吧没消费的也消费了
+// Consumer 消费者组 组不相同时都可以消费到,启动吧没消费的也消费了.
+// 回调返回 false 时不提交该消息, 在本分区内退避后重新回调同一条消息, 成功后才继续消费后续消息
 func (m MQKafkaService) Consumer(topic, _, _ string, f func(b model.ConsumerMsg) bool) (func() error, error) {
+	return m.consume(topic, &Consumer{cb: f, workers: m.Config.Workers, queueSize: m.Config.WorkerQueueSize,
+		group: m.Config.Group, metrics: m.Config.Metrics})
+}
 
+// consume 在后台持续消费 topic, 连接异常时重建消费组
+func (m MQKafkaService) consume(topic string, consumer sarama.ConsumerGroupHandler) (func() error, error) {
 	ctx, cancel := context.WithCancel(context.Background())
-	consumer := Consumer{cb: f}
+	done := make(chan struct{})
+	if m.subs != nil {
+		m.subs.add(subscription{cancel: cancel, done: done})
+	}
 
 	go func() {
+		defer close(done)
 		for {
 			select {
 			case <-ctx.Done():
 				loging.Info("Error from consumer ctx done")
 				return
 			default:
-				if err1 := m.C.Consume(ctx, []string{topic}, &consumer); err1 != nil {
-					if errors.Is(err1, sarama.ErrClosedClient) || errors.Is(err1, sarama.ErrOutOfBrokers) || errors.Is(err1, sarama.ErrNotConnected) {
+				group := m.consumerGroup()
+				if err1 := group.Consume(ctx, []string{topic}, consumer); err1 != nil {
+					if errors.Is(err1, sarama.ErrClosedConsumerGroup) {
+						// 消费组已关闭, 不再消费
+						loging.Infof("Kafka consumer group of %s closed", topic)
+						return
+					}
+					if isConnError(err1) && m.conn != nil {
 						loging.Errorf("Kafka consumer error: %v, attempting to reconnect...", err1)
-						for {
-							time.Sleep(5 * time.Second) // 等待5秒后重试
-							newConsumerGroup, err := sarama.NewConsumerGroup(strings.Split(m.Config.Brokers, ","), m.Config.Group, m.Config.saram)
-							if err == nil {
-								m.C = newConsumerGroup
-								break
-							}
-							loging.Errorf("Failed to reconnect to Kafka, retrying...: %v", err)
+						// 多个订阅共享消费组, 只有一个协程重连, 其他等待后使用新的消费组
+						if err := m.conn.renew(ctx, group, err1); err != nil {
+							loging.Errorf("Kafka consumer of %s stopped reconnecting: %v", topic, err)
+							return
 						}
 						continue
 					}
@@ -63,14 +83,28 @@ func (m MQKafkaService) Consumer(topic, _, _ string, f func(b model.ConsumerMsg)
 		}
 	}()
 
+	// 停止拉取, 等待处理中的回调结束并在 Cleanup 中提交偏移量后关闭消费组
 	return func() error {
 		cancel()
-		return m.C.Close()
+		<-done
+		return m.closeGroup()
 	}, nil
 }
 
+// redeliveryInterval 回调返回 false 后第一次重新回调同一条消息的间隔, 之后每次翻倍, 最长 maxRedeliveryInterval
+var (
+	redeliveryInterval    = time.Second
+	maxRedeliveryInterval = 30 * time.Second
+)
+
 type Consumer struct {
 	cb func(msg model.ConsumerMsg) bool
+
+	workers   int // 大于 1 时使用 consumeConcurrently
+	queueSize int
+
+	group   string
+	metrics metrics.Metrics
 }
 
 func (consumer *Consumer) Setup(s sarama.ConsumerGroupSession) error {
@@ -83,18 +117,53 @@ func (consumer *Consumer) Cleanup(s sarama.ConsumerGroupSession) error {
 }
 
 func (consumer *Consumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
-	for message := range claim.Messages() {
-		//loging.Infof("Partition:%d, Offset:%d, key:%s", message.Partition, message.Offset, string(message.Key))
-		if !consumer.cb(model.ConsumerMsg{
-			Value:     message.Value,
-			Partition: message.Partition,
-			Offset:    message.Offset}) {
-			// 如果回调函数返回 false，不确认消息
-			loging.Warnf("Callback returned false, not marking message as processed. Partition:%d, Offset:%d, key:%s, value:%s", message.Partition, message.Offset, string(message.Key), string(message.Value))
-			continue
+	if consumer.workers > 1 {
+		return consumer.consumeConcurrently(session, claim)
+	}
+	mt := metrics.OrNop(consumer.metrics)
+	for {
+		select {
+		case message, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+			//loging.Infof("Partition:%d, Offset:%d, key:%s", message.Partition, message.Offset, string(message.Key))
+			if !consumer.handle(session, message) {
+				// 会话结束前没有处理成功, 不确认该消息, 下次会话从它重新消费
+				return nil
+			}
+			session.MarkMessage(message, "")
+			mt.Lag(message.Topic, consumer.group, message.Partition, claim.HighWaterMarkOffset()-message.Offset-1)
+		case <-session.Context().Done():
+			// 会话结束, 不再处理已拉取的消息
+			return nil
 		}
-		session.MarkMessage(message, "")
 	}
+}
 
-	return nil
+// handle 回调直到返回 true, 失败时退避后重试同一条消息, 不结束会话以免触发重平衡.
+// 会话结束时返回 false
+func (consumer *Consumer) handle(session sarama.ConsumerGroupSession, message *sarama.ConsumerMessage) bool {
+	mt := metrics.OrNop(consumer.metrics)
+	wait := redeliveryInterval
+	for {
+		start := time.Now()
+		msg := toConsumerMsg(message)
+		msg.Context = session.Context()
+		ok := consumer.cb(msg)
+		mt.Consumed(message.Topic, message.Partition, time.Since(start), ok)
+		if ok {
+			return true
+		}
+		// 如果回调函数返回 false，不确认消息, 等待后重新回调, 后续消息的偏移量不会越过它提交
+		loging.Warnf("Callback returned false, redelivering in %v. Partition:%d, Offset:%d, key:%s, value:%s", wait, message.Partition, message.Offset, string(message.Key), string(message.Value))
+		select {
+		case <-session.Context().Done():
+			return false
+		case <-time.After(wait):
+		}
+		if wait *= 2; wait > maxRedeliveryInterval {
+			wait = maxRedeliveryInterval
+		}
+	}
 }
@@ -0,0 +1,83 @@
+package kafka
+
+import (
+	"context"
+	"github.com/IBM/sarama"
+	"github.com/jifuy/commongo/mq/model"
+	"testing"
+)
+
+func TestConsumeClaimRedelivers(t *testing.T) {
+	redeliveryInterval = 0
+	var seen []int64
+	fails := 2
+	c := &Consumer{cb: func(msg model.ConsumerMsg) bool {
+		seen = append(seen, msg.Offset)
+		if msg.Offset == 2 && fails > 0 {
+			fails--
+			return false
+		}
+		return true
+	}}
+
+	session := &fakeSession{ctx: context.Background()}
+	claim := &fakeClaim{msgs: make(chan *sarama.ConsumerMessage, 10)}
+	for i := int64(0); i < 5; i++ {
+		claim.msgs <- &sarama.ConsumerMessage{Topic: "unios-alarm-std", Offset: i}
+	}
+	close(claim.msgs)
+	// 失败的消息在本次会话内重新回调, 不结束会话
+	if err := c.ConsumeClaim(session, claim); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []int64{0, 1, 2, 2, 2, 3, 4}
+	if len(seen) != len(want) {
+		t.Fatalf("seen = %v, want %v", seen, want)
+	}
+	for i := range want {
+		if seen[i] != want[i] {
+			t.Fatalf("seen = %v, want %v", seen, want)
+		}
+	}
+	if len(session.marked) != 5 || session.marked[4] != 4 {
+		t.Fatalf("marked = %v", session.marked)
+	}
+}
+
+func TestConsumeClaimStopsOnFailure(t *testing.T) {
+	redeliveryInterval = 0
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var seen []int64
+	c := &Consumer{cb: func(msg model.ConsumerMsg) bool {
+		seen = append(seen, msg.Offset)
+		if msg.Offset == 2 && len(seen) > 5 {
+			// 一直失败直到会话结束
+			cancel()
+		}
+		return msg.Offset != 2
+	}}
+
+	session := &fakeSession{ctx: ctx}
+	claim := &fakeClaim{msgs: make(chan *sarama.ConsumerMessage, 10)}
+	for i := int64(0); i < 5; i++ {
+		claim.msgs <- &sarama.ConsumerMessage{Topic: "unios-alarm-std", Offset: i}
+	}
+	close(claim.msgs)
+	if err := c.ConsumeClaim(session, claim); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, offset := range seen {
+		if offset > 2 {
+			t.Fatalf("consumed after failure: %v", seen)
+		}
+	}
+	// 提交的位置不能越过失败的消息
+	for _, offset := range session.marked {
+		if offset >= 2 {
+			t.Fatalf("marked = %v", session.marked)
+		}
+	}
+}
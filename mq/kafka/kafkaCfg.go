@@ -6,8 +6,9 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"github.com/IBM/sarama"
+	"github.com/jifuy/commongo/mq/metrics"
+	"github.com/jifuy/commongo/mq/model"
 	"github.com/pkg/errors"
-	uuid "github.com/satori/go.uuid"
 	"github.com/xdg-go/scram"
 	"io/ioutil"
 	"strconv"
@@ -15,8 +16,9 @@ import (
 	"time"
 )
 
+// NewUUIDStr 同 model.NewUUIDStr, 保留给已有调用方
 func NewUUIDStr() string {
-	return strings.ReplaceAll(uuid.NewV4().String(), "-", "")
+	return model.NewUUIDStr()
 }
 
 const (
@@ -34,6 +36,8 @@ type Config struct {
 	Group    string
 	Assignor string
 	Oldest   bool
+	// 只读取已提交事务的消息 isolation.level=read_committed
+	ReadCommitted bool
 
 	// Sasl
 	SaslEnable bool
@@ -65,6 +69,26 @@ type Config struct {
 	saram   *sarama.Config
 
 	MaxProcessingTimeMilliSecond int
+
+	// 消费者时 每个分区并发处理的协程数, 大于 1 时按 key 分配协程保证同 key 顺序, 只提交连续处理完成的偏移量
+	Workers         int
+	WorkerQueueSize int // 每个协程的待处理队列长度, 默认 100
+
+	// 生产者攒批、压缩和确认设置, 异步生产者通过 OnDelivery/DeliveryChan 返回投递结果
+	LingerMilliSecond int    // 攒批等待时间
+	BatchSize         int    // 攒够多少条消息发送一批
+	Compression       string // 压缩 gzip/snappy/lz4/zstd, 默认不压缩
+	Idempotent        bool   // 幂等发送, 要求 acks 为 all
+	Acks              string // all/-1, local/1, none/0, 默认 local
+	// 事务 id, 设置后开启事务并强制幂等; ConsumeTransform 中作为前缀, 每个分区使用 前缀-topic-分区
+	TransactionalID string
+	// 设置 DeliveryChan 时调用方必须持续读取, 否则发送会阻塞
+	OnDelivery   func(r DeliveryResult)
+	DeliveryChan chan DeliveryResult
+
+	Metrics metrics.Metrics // 消费和发送指标, 为空时不记录
+
+	Reconnect ReconnectPolicy // 同步生产者和消费组连接断开后的重连策略
 }
 
 func (c *Config) newTLSConfiguration() (*tls.Config, error) {
@@ -129,6 +153,9 @@ func (c *Config) InitSarama() error {
 		saramaConfig.Consumer.MaxProcessingTime = time.Duration(c.MaxProcessingTimeMilliSecond) * time.Millisecond
 	}
 
+	if c.Version == "" {
+		c.Version = DEFAULT_VERSION
+	}
 	ver, err := sarama.ParseKafkaVersion(c.Version)
 	if err != nil {
 		return errors.Errorf("Error parsing Kafka version: %v", err)
@@ -209,6 +236,9 @@ func (c *Config) InitSarama() error {
 	if c.Oldest {
 		saramaConfig.Consumer.Offsets.Initial = sarama.OffsetOldest
 	}
+	if c.ReadCommitted {
+		saramaConfig.Consumer.IsolationLevel = sarama.ReadCommitted
+	}
 
 	// producer
 	// The total number of times to retry sending a message (default 3).
@@ -220,6 +250,10 @@ func (c *Config) InitSarama() error {
 	// Successes channel.Must be true to be used in a SyncProducer
 	saramaConfig.Producer.Return.Successes = true
 
+	if err = c.initProducer(saramaConfig); err != nil {
+		return err
+	}
+
 	//增加backoff 的设置
 	if c.Backoff != "" {
 		intbackoff, _ := strconv.Atoi(c.Backoff)
@@ -233,6 +267,58 @@ func (c *Config) InitSarama() error {
 	return nil
 }
 
+// initProducer 应用攒批、压缩、确认级别和幂等设置
+func (c *Config) initProducer(saramaConfig *sarama.Config) error {
+	if c.LingerMilliSecond > 0 {
+		saramaConfig.Producer.Flush.Frequency = time.Duration(c.LingerMilliSecond) * time.Millisecond
+	}
+	if c.BatchSize > 0 {
+		saramaConfig.Producer.Flush.Messages = c.BatchSize
+	}
+
+	switch strings.ToLower(c.Compression) {
+	case "", "none":
+		saramaConfig.Producer.Compression = sarama.CompressionNone
+	case "gzip":
+		saramaConfig.Producer.Compression = sarama.CompressionGZIP
+	case "snappy":
+		saramaConfig.Producer.Compression = sarama.CompressionSnappy
+	case "lz4":
+		saramaConfig.Producer.Compression = sarama.CompressionLZ4
+	case "zstd":
+		saramaConfig.Producer.Compression = sarama.CompressionZSTD
+	default:
+		return errors.Errorf("Unrecognized compression: %s, acceptable compressions are gzip/snappy/lz4/zstd", c.Compression)
+	}
+
+	switch strings.ToLower(c.Acks) {
+	case "":
+	case "all", "-1":
+		saramaConfig.Producer.RequiredAcks = sarama.WaitForAll
+	case "local", "1":
+		saramaConfig.Producer.RequiredAcks = sarama.WaitForLocal
+	case "none", "0":
+		saramaConfig.Producer.RequiredAcks = sarama.NoResponse
+	default:
+		return errors.Errorf("Unrecognized acks: %s, acceptable acks are all/local/none", c.Acks)
+	}
+
+	if c.TransactionalID != "" {
+		// 事务要求幂等
+		c.Idempotent = true
+		saramaConfig.Producer.Transaction.ID = c.TransactionalID
+	}
+	if c.Idempotent {
+		if c.Acks != "" && saramaConfig.Producer.RequiredAcks != sarama.WaitForAll {
+			return errors.Errorf("idempotent producer requires acks all, got %s", c.Acks)
+		}
+		saramaConfig.Producer.Idempotent = true
+		saramaConfig.Producer.RequiredAcks = sarama.WaitForAll
+		saramaConfig.Net.MaxOpenRequests = 1
+	}
+	return nil
+}
+
 var SHA256 scram.HashGeneratorFcn = sha256.New
 var SHA512 scram.HashGeneratorFcn = sha512.New
 
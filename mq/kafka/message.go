@@ -0,0 +1,50 @@
+package kafka
+
+import (
+	"fmt"
+	"github.com/IBM/sarama"
+	"github.com/jifuy/commongo/mq/model"
+)
+
+// toProducerMessage 把 model.Message 转为 sarama 消息, Tags 和 MessageID 放在记录头中
+func toProducerMessage(msg *model.Message) *sarama.ProducerMessage {
+	pm := &sarama.ProducerMessage{Topic: msg.Topic, Value: sarama.ByteEncoder(msg.Value), Timestamp: msg.Timestamp}
+	if msg.Key != "" {
+		pm.Key = sarama.StringEncoder(msg.Key) //确保消息被发送到同一个分区保证消息顺序性
+	}
+	for k, v := range msg.Headers {
+		pm.Headers = append(pm.Headers, sarama.RecordHeader{Key: []byte(k), Value: []byte(v)})
+	}
+	if msg.Tags != "" {
+		pm.Headers = append(pm.Headers, sarama.RecordHeader{Key: []byte(model.HeaderTags), Value: []byte(msg.Tags)})
+	}
+	if msg.MessageID != "" {
+		pm.Headers = append(pm.Headers, sarama.RecordHeader{Key: []byte(model.HeaderMessageID), Value: []byte(msg.MessageID)})
+	}
+	return pm
+}
+
+func toConsumerMsg(message *sarama.ConsumerMessage) model.ConsumerMsg {
+	msg := model.ConsumerMsg{
+		Value:     message.Value,
+		Partition: message.Partition,
+		Offset:    message.Offset,
+		Topic:     message.Topic,
+		Key:       string(message.Key),
+		Timestamp: message.Timestamp,
+	}
+	if len(message.Headers) > 0 {
+		msg.Headers = make(map[string]string, len(message.Headers))
+		for _, h := range message.Headers {
+			if h != nil {
+				msg.Headers[string(h.Key)] = string(h.Value)
+			}
+		}
+		msg.Tags = msg.Headers[model.HeaderTags]
+		msg.MessageID = msg.Headers[model.HeaderMessageID]
+	}
+	if msg.MessageID == "" {
+		msg.MessageID = fmt.Sprintf("%s-%d-%d", message.Topic, message.Partition, message.Offset)
+	}
+	return msg
+}
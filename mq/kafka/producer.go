@@ -1,9 +1,14 @@
 package kafka
 
 import (
+	"context"
 	"github.com/IBM/sarama"
 	"github.com/jifuy/commongo/loging"
+	"github.com/jifuy/commongo/mq/metrics"
+	"github.com/jifuy/commongo/mq/model"
+	"io"
 	"strings"
+	"time"
 )
 
 // MQKafkaService Kafka消息队列
@@ -12,40 +17,65 @@ type MQKafkaService struct {
 	P       sarama.SyncProducer
 	C       sarama.ConsumerGroup
 	Config  Config
+
+	subs *subscriptions // 消费者时 后台消费协程, Shutdown 时等待退出
+	conn *liveClient    // 当前使用的 C 或 P, 重连后替换, C 和 P 只是创建时的客户端
 }
 
 func NewKafkaProducer(config Config) (MQKafkaService, func() error, error) {
 	// 连接kafka
-	client, err := sarama.NewSyncProducer(strings.Split(config.Brokers, ","), config.saram)
+	brokers := strings.Split(config.Brokers, ",")
+	client, err := sarama.NewSyncProducer(brokers, config.saram)
 	if err != nil {
 		return MQKafkaService{}, nil, err
 	}
-	return MQKafkaService{P: client},
-		func() error {
-			return client.Close()
-		}, nil
+	conn := newLiveClient(client, config.Reconnect, func() (io.Closer, error) {
+		p, err := sarama.NewSyncProducer(brokers, config.saram)
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	})
+	return MQKafkaService{P: client, Config: config, conn: conn}, conn.close, nil
 }
 
 // 同一分区只能被同消费组的一个消费组消费，可以发送到多个分区，相同消费组就能消费同一个topic了。
 // Producer 生产者 当你发送消息到一个尚不存在的主题时，Kafka 默认会为该主题创建一个分区。这个分区被称为“分区0”。所以在初始阶段，发送到新主题的所有消息都会被发送到这个分区。也可以创建一个名为 “my-topic” 的主题，并指定了3个分区
 func (m MQKafkaService) Producer(topic string, key, _ string, data []byte) error {
-	var k sarama.Encoder
-	if key == "" {
-		k = nil
-	} else {
-		k = sarama.StringEncoder(key)
-	}
-	// 构造一个消息
-	msg := &sarama.ProducerMessage{}
-	msg.Topic = topic
-	msg.Key = k //确保消息被发送到同一个分区保证消息顺序性 会hash到不同分区 负载均衡
-	msg.Value = sarama.ByteEncoder(data)
+	return m.SendMessage(context.Background(), &model.Message{Topic: topic, Key: key, Value: data})
+}
+
+// SendMessage 发送带记录头的消息, 同步等待 broker 确认
+func (m MQKafkaService) SendMessage(_ context.Context, msg *model.Message) error {
 	// 发送消息
-	pid, offset, err := m.P.SendMessage(msg)
+	p := m.producer()
+	start := time.Now()
+	pid, offset, err := p.SendMessage(toProducerMessage(msg))
+	metrics.OrNop(m.Config.Metrics).Sent(msg.Topic, time.Since(start), err)
+	if err != nil && isConnError(err) && m.conn != nil {
+		// 后台重建生产者, 之后的发送使用新的连接
+		m.conn.renewAsync(p, err)
+	}
 	if err != nil {
 		loging.Error("send msg failed, err:", err)
 		return err
 	}
-	loging.Infof("pid:%v offset:%v\n", pid, offset)
+	loging.Debugf("pid:%v offset:%v\n", pid, offset)
 	return nil
 }
+
+// producer 当前使用的生产者
+func (m MQKafkaService) producer() sarama.SyncProducer {
+	if m.conn == nil {
+		return m.P
+	}
+	return m.conn.get().(sarama.SyncProducer)
+}
+
+// consumerGroup 当前使用的消费组
+func (m MQKafkaService) consumerGroup() sarama.ConsumerGroup {
+	if m.conn == nil {
+		return m.C
+	}
+	return m.conn.get().(sarama.ConsumerGroup)
+}
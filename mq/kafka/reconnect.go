@@ -0,0 +1,200 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"github.com/IBM/sarama"
+	"github.com/jifuy/commongo/loging"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var errClientClosed = errors.New("kafka: client closed")
+
+// ReconnectState 重连状态, 通过 ReconnectPolicy.OnStateChange 通知
+type ReconnectState int
+
+const (
+	StateConnected    ReconnectState = iota // 重连成功
+	StateReconnecting                       // 连接断开, 开始重连
+	StateFailed                             // 重连次数用尽或已关闭, 不再重连
+)
+
+func (s ReconnectState) String() string {
+	switch s {
+	case StateConnected:
+		return "connected"
+	case StateReconnecting:
+		return "reconnecting"
+	case StateFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+// ReconnectPolicy 连接断开后的重连策略, 等待时间按指数增长并随机浮动
+type ReconnectPolicy struct {
+	InitialBackoff time.Duration // 第一次重连前的等待, 默认 1s
+	MaxBackoff     time.Duration // 等待时间上限, 默认 1min
+	Jitter         float64       // 等待时间的随机浮动比例 0~1, 默认 0.2
+	MaxAttempts    int           // 最大重连次数, 0 为不限
+	// OnStateChange 状态变化回调, StateReconnecting 时 err 为断开原因, StateFailed 时为最后一次重连的错误
+	OnStateChange func(state ReconnectState, err error)
+}
+
+func (p ReconnectPolicy) withDefaults() ReconnectPolicy {
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = time.Second
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = time.Minute
+	}
+	if p.MaxBackoff < p.InitialBackoff {
+		p.MaxBackoff = p.InitialBackoff
+	}
+	if p.Jitter <= 0 || p.Jitter > 1 {
+		p.Jitter = 0.2
+	}
+	return p
+}
+
+// backoff 第 attempt 次重连前的等待时间, attempt 从 1 开始
+func (p ReconnectPolicy) backoff(attempt int) time.Duration {
+	d := p.InitialBackoff
+	for i := 1; i < attempt && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return d + time.Duration(float64(d)*p.Jitter*(rand.Float64()*2-1))
+}
+
+func (p ReconnectPolicy) notify(state ReconnectState, err error) {
+	if p.OnStateChange != nil {
+		p.OnStateChange(state, err)
+	}
+}
+
+// reconnect 按策略重试 dial 直到成功、次数用尽、客户端关闭或 ctx 结束
+func (p ReconnectPolicy) reconnect(ctx context.Context, cause error, dial func() error) error {
+	p = p.withDefaults()
+	p.notify(StateReconnecting, cause)
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(p.backoff(attempt)):
+		}
+		err := dial()
+		if err == nil {
+			p.notify(StateConnected, nil)
+			return nil
+		}
+		if errors.Is(err, errClientClosed) || p.MaxAttempts > 0 && attempt >= p.MaxAttempts {
+			p.notify(StateFailed, err)
+			return err
+		}
+		loging.Errorf("Failed to reconnect to Kafka (attempt %d), retrying...: %v", attempt, err)
+	}
+}
+
+// isConnError 需要重建客户端的错误
+func isConnError(err error) bool {
+	return errors.Is(err, sarama.ErrClosedClient) || errors.Is(err, sarama.ErrOutOfBrokers) || errors.Is(err, sarama.ErrNotConnected)
+}
+
+// liveClient 持有当前使用的消费组或生产者, 重连成功后替换并关闭旧的; close 总是关闭当前的
+type liveClient struct {
+	policy ReconnectPolicy
+	dial   func() (io.Closer, error)
+
+	mu           sync.Mutex
+	c            io.Closer
+	closed       bool
+	reconnecting chan struct{} // 重连结束时关闭
+}
+
+func newLiveClient(c io.Closer, policy ReconnectPolicy, dial func() (io.Closer, error)) *liveClient {
+	return &liveClient{c: c, policy: policy, dial: dial}
+}
+
+func (l *liveClient) get() io.Closer {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.c
+}
+
+// renew 替换失效的 old. 已被其他协程替换时直接返回, 其他协程正在重连时等待其结束
+func (l *liveClient) renew(ctx context.Context, old io.Closer, cause error) error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return errClientClosed
+	}
+	if l.c != old {
+		l.mu.Unlock()
+		return nil
+	}
+	if ch := l.reconnecting; ch != nil {
+		l.mu.Unlock()
+		select {
+		case <-ch:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	ch := make(chan struct{})
+	l.reconnecting = ch
+	l.mu.Unlock()
+
+	err := l.policy.reconnect(ctx, cause, func() error {
+		c, err := l.dial()
+		if err != nil {
+			return err
+		}
+		l.mu.Lock()
+		if l.closed {
+			l.mu.Unlock()
+			c.Close()
+			return errClientClosed
+		}
+		old := l.c
+		l.c = c
+		l.mu.Unlock()
+		old.Close()
+		return nil
+	})
+
+	l.mu.Lock()
+	l.reconnecting = nil
+	l.mu.Unlock()
+	close(ch)
+	return err
+}
+
+func (l *liveClient) close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	c := l.c
+	l.mu.Unlock()
+	return c.Close()
+}
+
+// renewAsync 在后台重连, 正在重连时不重复启动
+func (l *liveClient) renewAsync(old io.Closer, cause error) {
+	l.mu.Lock()
+	busy := l.closed || l.c != old || l.reconnecting != nil
+	l.mu.Unlock()
+	if !busy {
+		go l.renew(context.Background(), old, cause)
+	}
+}
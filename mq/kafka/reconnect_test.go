@@ -0,0 +1,82 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeCloser struct {
+	mu     sync.Mutex
+	closed bool
+}
+
+func (c *fakeCloser) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+func TestReconnect(t *testing.T) {
+	p := ReconnectPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: 300 * time.Millisecond}.withDefaults()
+	for attempt, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 5: 300 * time.Millisecond} {
+		if d := p.backoff(attempt); d < want*8/10 || d > want*12/10 {
+			t.Fatalf("backoff(%d) = %v, want %v±20%%", attempt, d, want)
+		}
+	}
+
+	var mu sync.Mutex
+	var states []ReconnectState
+	policy := ReconnectPolicy{InitialBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond, MaxAttempts: 3,
+		OnStateChange: func(state ReconnectState, err error) {
+			mu.Lock()
+			states = append(states, state)
+			mu.Unlock()
+		}}
+	fails := 2
+	old := &fakeCloser{}
+	l := newLiveClient(old, policy, func() (io.Closer, error) {
+		if fails > 0 {
+			fails--
+			return nil, errors.New("broker down")
+		}
+		return &fakeCloser{}, nil
+	})
+	if err := l.renew(context.Background(), old, errors.New("eof")); err != nil {
+		t.Fatal(err)
+	}
+	current := l.get().(*fakeCloser)
+	if current == old || !old.closed {
+		t.Fatal("old client not replaced and closed")
+	}
+	// 旧客户端已被替换, 其他订阅再次重连时直接返回
+	if err := l.renew(context.Background(), old, errors.New("eof")); err != nil || l.get() != current {
+		t.Fatalf("renew stale client: %v", err)
+	}
+
+	fails = 10
+	if err := l.renew(context.Background(), current, errors.New("eof")); err == nil {
+		t.Fatal("expected error after max attempts")
+	}
+	if err := l.close(); err != nil || !current.closed {
+		t.Fatal("close did not close the current client")
+	}
+	if err := l.renew(context.Background(), current, errors.New("eof")); err != errClientClosed {
+		t.Fatalf("renew after close: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	want := []ReconnectState{StateReconnecting, StateConnected, StateReconnecting, StateFailed}
+	if len(states) != len(want) {
+		t.Fatalf("states = %v", states)
+	}
+	for i := range want {
+		if states[i] != want[i] {
+			t.Fatalf("states = %v", states)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"github.com/IBM/sarama"
+	"sync"
+)
+
+// subscription 后台消费协程, cancel 后 done 在协程退出时关闭
+type subscription struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+type subscriptions struct {
+	mu   sync.Mutex
+	list []subscription
+}
+
+func (s *subscriptions) add(sub subscription) {
+	s.mu.Lock()
+	s.list = append(s.list, sub)
+	s.mu.Unlock()
+}
+
+// shutdown 取消全部订阅并等待消费协程退出
+func (s *subscriptions) shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	list := s.list
+	s.list = nil
+	s.mu.Unlock()
+	for _, sub := range list {
+		sub.cancel()
+	}
+	for _, sub := range list {
+		select {
+		case <-sub.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Shutdown 停止拉取消息, 等待处理中的回调结束并提交偏移量后关闭消费组.
+// ctx 结束时不再等待, 直接关闭消费组并返回 ctx.Err()
+func (m MQKafkaService) Shutdown(ctx context.Context) error {
+	var err error
+	if m.subs != nil {
+		err = m.subs.shutdown(ctx)
+	}
+	if m.C != nil {
+		if e := m.closeGroup(); err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// closeGroup 关闭当前使用的消费组, 已关闭时不返回错误
+func (m MQKafkaService) closeGroup() error {
+	var err error
+	if m.conn != nil {
+		err = m.conn.close()
+	} else {
+		err = m.C.Close()
+	}
+	if err != nil && !errors.Is(err, sarama.ErrClosedConsumerGroup) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"github.com/IBM/sarama"
+	"github.com/jifuy/commongo/loging"
+	"github.com/jifuy/commongo/mq/model"
+	"github.com/pkg/errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// txnRetryInterval 事务失败后重试同一条消息的间隔
+var txnRetryInterval = time.Second
+
+// commitRetries 提交事务遇到可重试错误时最多重试的次数, 第一次间隔 commitRetryInterval, 之后每次翻倍
+var (
+	commitRetries       = 5
+	commitRetryInterval = 100 * time.Millisecond
+)
+
+// txnProducer 事务生产者, 同一时间只进行一个事务
+type txnProducer struct {
+	p    sarama.AsyncProducer
+	done chan struct{}
+}
+
+func newTxnProducer(brokers []string, saram *sarama.Config, id string) (*txnProducer, error) {
+	cfg := *saram
+	cfg.Producer.Transaction.ID = id
+	// 发送结果由提交事务返回
+	cfg.Producer.Return.Successes = false
+	p, err := sarama.NewAsyncProducer(brokers, &cfg)
+	if err != nil {
+		return nil, err
+	}
+	return wrapTxnProducer(p), nil
+}
+
+func wrapTxnProducer(p sarama.AsyncProducer) *txnProducer {
+	t := &txnProducer{p: p, done: make(chan struct{})}
+	go func() {
+		defer close(t.done)
+		for e := range p.Errors() {
+			loging.Errorf("send msg in transaction failed, topic:%s, err:%v", e.Msg.Topic, e.Err)
+		}
+	}()
+	return t
+}
+
+// run 在一个事务中执行 f, f 返回错误或提交失败时回滚. 提交遇到可重试错误时退避后重试,
+// 超过 commitRetries 次后回滚事务
+func (t *txnProducer) run(f func() error) error {
+	if err := t.p.BeginTxn(); err != nil {
+		return err
+	}
+	if err := f(); err != nil {
+		if e := t.p.AbortTxn(); e != nil {
+			loging.Errorf("abort transaction failed: %v", e)
+		}
+		return err
+	}
+	err := t.p.CommitTxn()
+	wait := commitRetryInterval
+	for i := 0; err != nil; i++ {
+		status := t.p.TxnStatus()
+		if status&sarama.ProducerTxnFlagFatalError != 0 {
+			// 生产者已不可用, 需要重新创建
+			return err
+		}
+		if status&sarama.ProducerTxnFlagAbortableError != 0 || i >= commitRetries {
+			loging.Errorf("commit transaction failed after %d retries, aborting: %v", i, err)
+			if e := t.p.AbortTxn(); e != nil {
+				return e
+			}
+			return err
+		}
+		time.Sleep(wait)
+		wait *= 2
+		err = t.p.CommitTxn()
+	}
+	return nil
+}
+
+// send 在当前事务中发送消息, 输入缓冲满时阻塞到 ctx 结束
+func (t *txnProducer) send(ctx context.Context, msg *sarama.ProducerMessage) error {
+	select {
+	case t.p.Input() <- msg:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (t *txnProducer) fatal() bool {
+	return t.p.TxnStatus()&sarama.ProducerTxnFlagFatalError != 0
+}
+
+func (t *txnProducer) close() error {
+	t.p.AsyncClose()
+	<-t.done
+	return nil
+}
+
+// MQKafkaTxn 事务生产者, 一次事务中的消息全部可见或全部不可见, 消费者需开启 ReadCommitted
+type MQKafkaTxn struct {
+	mu sync.Mutex
+	t  *txnProducer
+}
+
+func NewKafkaTxnProducer(config Config) (*MQKafkaTxn, func() error, error) {
+	if config.TransactionalID == "" {
+		return nil, nil, errors.New("kafka: TransactionalID is required for transactional producer")
+	}
+	t, err := newTxnProducer(strings.Split(config.Brokers, ","), config.saram, config.TransactionalID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &MQKafkaTxn{t: t}, t.close, nil
+}
+
+// Producer 生产者 每条消息单独一个事务
+func (m *MQKafkaTxn) Producer(topic string, key, _ string, data []byte) error {
+	return m.SendMessages(context.Background(), &model.Message{Topic: topic, Key: key, Value: data})
+}
+
+// SendMessage 每条消息单独一个事务
+func (m *MQKafkaTxn) SendMessage(ctx context.Context, msg *model.Message) error {
+	return m.SendMessages(ctx, msg)
+}
+
+// SendMessages 在一个事务中发送全部消息
+func (m *MQKafkaTxn) SendMessages(ctx context.Context, msgs ...*model.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.t.run(func() error {
+		for _, msg := range msgs {
+			if err := m.t.send(ctx, toProducerMessage(msg)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ConsumeTransform 消费-转换-发送 f 返回的输出消息和输入消息的偏移量在同一事务中提交, 重平衡时不会重复发送.
+// f 返回错误或事务失败时间隔后重试同一条消息, 不需要输出时返回空切片; 要求配置 TransactionalID 和 Group
+func (m MQKafkaService) ConsumeTransform(topic string, f func(msg model.ConsumerMsg) ([]*model.Message, error)) (func() error, error) {
+	if m.Config.TransactionalID == "" {
+		return nil, errors.New("kafka: TransactionalID is required for ConsumeTransform")
+	}
+	brokers := strings.Split(m.Config.Brokers, ",")
+	return m.consume(topic, &txnConsumer{
+		cb:    f,
+		group: m.Config.Group,
+		newProducer: func(topic string, partition int32) (*txnProducer, error) {
+			// 每个分区固定的事务 id, 重平衡后新的持有者会隔离旧的生产者
+			return newTxnProducer(brokers, m.Config.saram, fmt.Sprintf("%s-%s-%d", m.Config.TransactionalID, topic, partition))
+		},
+	})
+}
+
+type txnConsumer struct {
+	cb          func(msg model.ConsumerMsg) ([]*model.Message, error)
+	group       string
+	newProducer func(topic string, partition int32) (*txnProducer, error)
+}
+
+func (c *txnConsumer) Setup(s sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+// Cleanup 偏移量已随事务提交
+func (c *txnConsumer) Cleanup(s sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+func (c *txnConsumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	t, err := c.newProducer(claim.Topic(), claim.Partition())
+	if err != nil {
+		return err
+	}
+	defer t.close()
+
+	for {
+		select {
+		case message, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+			for {
+				err := c.process(session.Context(), t, message)
+				if err == nil {
+					break
+				}
+				loging.Warnf("Transform failed, retrying. Partition:%d, Offset:%d, err:%v", message.Partition, message.Offset, err)
+				if t.fatal() {
+					return err
+				}
+				select {
+				case <-session.Context().Done():
+					return nil
+				case <-time.After(txnRetryInterval):
+				}
+			}
+		case <-session.Context().Done():
+			return nil
+		}
+	}
+}
+
+func (c *txnConsumer) process(ctx context.Context, t *txnProducer, message *sarama.ConsumerMessage) error {
+	outs, err := c.cb(toConsumerMsg(message))
+	if err != nil {
+		return err
+	}
+	return t.run(func() error {
+		for _, out := range outs {
+			if err := t.send(ctx, toProducerMessage(out)); err != nil {
+				return err
+			}
+		}
+		return t.p.AddMessageToTxn(message, c.group, nil)
+	})
+}
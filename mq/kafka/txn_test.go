@@ -0,0 +1,122 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/jifuy/commongo/mq/model"
+	"strings"
+	"testing"
+	"time"
+)
+
+// txnMock 提交前等待 mock 处理完本事务的一条消息, 与真实生产者提交时 flush 一致
+type txnMock struct {
+	*mocks.AsyncProducer
+	checked chan struct{}
+}
+
+func (m txnMock) CommitTxn() error {
+	<-m.checked
+	return m.AsyncProducer.CommitTxn()
+}
+
+func TestConsumeTransform(t *testing.T) {
+	txnRetryInterval = 10 * time.Millisecond
+	config := Config{Brokers: "127.0.0.1:9092", Group: "normalizer", TransactionalID: "normalizer", ReadCommitted: true}
+	if err := config.InitSarama(); err != nil {
+		t.Fatal(err)
+	}
+	if !config.saram.Producer.Idempotent || config.saram.Consumer.IsolationLevel != sarama.ReadCommitted {
+		t.Fatal("transaction config not applied")
+	}
+
+	cfg := *config.saram
+	cfg.Producer.Return.Successes = false
+	mock := txnMock{AsyncProducer: mocks.NewAsyncProducer(t, &cfg), checked: make(chan struct{}, 2)}
+	var outs []string
+	check := func(msg *sarama.ProducerMessage) error {
+		v, _ := msg.Value.Encode()
+		outs = append(outs, string(v))
+		mock.checked <- struct{}{}
+		return nil
+	}
+	mock.ExpectInputWithMessageCheckerFunctionAndSucceed(check).ExpectInputWithMessageCheckerFunctionAndSucceed(check)
+	var ids []string
+	failed := false
+	c := &txnConsumer{
+		group: config.Group,
+		newProducer: func(topic string, partition int32) (*txnProducer, error) {
+			ids = append(ids, config.TransactionalID+"-"+topic)
+			return wrapTxnProducer(mock), nil
+		},
+		cb: func(msg model.ConsumerMsg) ([]*model.Message, error) {
+			if !failed {
+				// 第一次失败, 重试同一条消息
+				failed = true
+				return nil, errors.New("db down")
+			}
+			return []*model.Message{{Topic: "unios-alarm-norm", Key: msg.Key, Value: []byte(strings.ToUpper(string(msg.Value)))}}, nil
+		},
+	}
+
+	session := &fakeSession{ctx: context.Background()}
+	claim := &fakeClaim{msgs: make(chan *sarama.ConsumerMessage, 2)}
+	claim.msgs <- &sarama.ConsumerMessage{Topic: "unios-alarm-std", Key: []byte("a"), Value: []byte("msg"), Offset: 0}
+	claim.msgs <- &sarama.ConsumerMessage{Topic: "unios-alarm-std", Key: []byte("b"), Value: []byte("msg"), Offset: 1}
+	close(claim.msgs)
+	if err := c.ConsumeClaim(session, claim); err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids[0] != "normalizer-unios-alarm-std" || !failed {
+		t.Fatalf("ids = %v", ids)
+	}
+	if len(outs) != 2 || outs[0] != "MSG" {
+		t.Fatalf("outs = %v", outs)
+	}
+	// 偏移量随事务提交, 不通过会话标记
+	if len(session.marked) != 0 {
+		t.Fatalf("marked = %v", session.marked)
+	}
+}
+
+// commitFailMock 提交总是返回可重试错误
+type commitFailMock struct {
+	*mocks.AsyncProducer
+	commits, aborts int
+}
+
+func (m *commitFailMock) CommitTxn() error {
+	m.commits++
+	return sarama.ErrNotEnoughReplicas
+}
+
+func (m *commitFailMock) AbortTxn() error {
+	m.aborts++
+	return nil
+}
+
+func (m *commitFailMock) TxnStatus() sarama.ProducerTxnStatusFlag {
+	return sarama.ProducerTxnFlagInTransaction | sarama.ProducerTxnFlagCommittingTransaction
+}
+
+func TestTxnCommitGivesUp(t *testing.T) {
+	commitRetries, commitRetryInterval = 3, time.Millisecond
+	config := Config{Brokers: "127.0.0.1:9092", TransactionalID: "normalizer"}
+	if err := config.InitSarama(); err != nil {
+		t.Fatal(err)
+	}
+	mock := &commitFailMock{AsyncProducer: mocks.NewAsyncProducer(t, config.saram)}
+	p := wrapTxnProducer(mock)
+	defer p.close()
+
+	err := p.run(func() error { return nil })
+	if !errors.Is(err, sarama.ErrNotEnoughReplicas) {
+		t.Fatalf("err = %v", err)
+	}
+	// 重试 commitRetries 次后回滚, 不再无限重试
+	if mock.commits != 4 || mock.aborts != 1 {
+		t.Fatalf("commits = %d, aborts = %d", mock.commits, mock.aborts)
+	}
+}
@@ -0,0 +1,105 @@
+package kafka
+
+import (
+	"github.com/IBM/sarama"
+	"github.com/jifuy/commongo/mq/metrics"
+	"hash/fnv"
+	"sync"
+)
+
+// consumeConcurrently 分区内并发处理, 同 key 的消息分到同一协程按顺序处理, 无 key 的消息轮询分配.
+// 回调返回 false 时与串行模式一样在协程内重试该消息, 偏移量停在最早未完成的消息
+func (consumer *Consumer) consumeConcurrently(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	queueSize := consumer.queueSize
+	if queueSize <= 0 {
+		queueSize = 100
+	}
+	mt := metrics.OrNop(consumer.metrics)
+	tracker := &offsetTracker{session: session, finished: make(map[int64]bool), lag: func(topic string, partition int32, next int64) {
+		mt.Lag(topic, consumer.group, partition, claim.HighWaterMarkOffset()-next)
+	}}
+	queues := make([]chan *sarama.ConsumerMessage, consumer.workers)
+	var wg sync.WaitGroup
+	for i := range queues {
+		queues[i] = make(chan *sarama.ConsumerMessage, queueSize)
+		wg.Add(1)
+		go func(queue chan *sarama.ConsumerMessage) {
+			defer wg.Done()
+			for message := range queue {
+				// 会话结束后不再处理, 未提交的消息重新消费
+				if session.Context().Err() != nil {
+					continue
+				}
+				if consumer.handle(session, message) {
+					tracker.done(message)
+				}
+			}
+		}(queues[i])
+	}
+	defer func() {
+		for _, queue := range queues {
+			close(queue)
+		}
+		// 等待处理中的消息完成, Cleanup 时一并提交
+		wg.Wait()
+	}()
+
+	next := 0
+	for {
+		select {
+		case message, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+			var i int
+			if len(message.Key) > 0 {
+				h := fnv.New32a()
+				h.Write(message.Key)
+				i = int(h.Sum32() % uint32(len(queues)))
+			} else {
+				i = next % len(queues)
+				next++
+			}
+			tracker.add(message.Offset)
+			select {
+			case queues[i] <- message:
+			case <-session.Context().Done():
+				return nil
+			}
+		case <-session.Context().Done():
+			return nil
+		}
+	}
+}
+
+// offsetTracker 记录分区内处理中的偏移量, 只标记连续处理完成的水位
+type offsetTracker struct {
+	session sarama.ConsumerGroupSession
+	lag     func(topic string, partition int32, next int64)
+
+	mu       sync.Mutex
+	inflight []int64 // 按拉取顺序递增
+	finished map[int64]bool
+}
+
+func (t *offsetTracker) add(offset int64) {
+	t.mu.Lock()
+	t.inflight = append(t.inflight, offset)
+	t.mu.Unlock()
+}
+
+func (t *offsetTracker) done(message *sarama.ConsumerMessage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.finished[message.Offset] = true
+	mark := int64(-1)
+	for len(t.inflight) > 0 && t.finished[t.inflight[0]] {
+		mark = t.inflight[0]
+		delete(t.finished, mark)
+		t.inflight = t.inflight[1:]
+	}
+	if mark >= 0 {
+		t.session.MarkOffset(message.Topic, message.Partition, mark+1, "")
+		t.lag(message.Topic, message.Partition, mark+1)
+	}
+}
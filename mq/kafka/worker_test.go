@@ -0,0 +1,115 @@
+package kafka
+
+import (
+	"context"
+	"github.com/IBM/sarama"
+	"github.com/jifuy/commongo/mq/model"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestConsumeConcurrently(t *testing.T) {
+	var mu sync.Mutex
+	seen := make(map[string][]int64)
+	c := &Consumer{workers: 4, cb: func(msg model.ConsumerMsg) bool {
+		// offset 0 最慢, 之后完成的消息不能越过它提交
+		if msg.Offset == 0 {
+			time.Sleep(100 * time.Millisecond)
+		}
+		mu.Lock()
+		seen[msg.Key] = append(seen[msg.Key], msg.Offset)
+		mu.Unlock()
+		return true
+	}}
+
+	session := &fakeSession{ctx: context.Background()}
+	claim := &fakeClaim{msgs: make(chan *sarama.ConsumerMessage, 100)}
+	keys := []string{"a", "b", "c", "d", "e"}
+	for i := int64(0); i < 50; i++ {
+		claim.msgs <- &sarama.ConsumerMessage{Topic: "unios-alarm-std", Key: []byte(keys[i%5]), Offset: i}
+	}
+	close(claim.msgs)
+	if err := c.ConsumeClaim(session, claim); err != nil {
+		t.Fatal(err)
+	}
+
+	for k, offsets := range seen {
+		if len(offsets) != 10 {
+			t.Fatalf("key %s offsets %v", k, offsets)
+		}
+		for i := 1; i < len(offsets); i++ {
+			if offsets[i] < offsets[i-1] {
+				t.Fatalf("key %s out of order %v", k, offsets)
+			}
+		}
+	}
+	for i := 1; i < len(session.marked); i++ {
+		if session.marked[i] <= session.marked[i-1] {
+			t.Fatalf("marked not increasing %v", session.marked)
+		}
+	}
+	if len(session.marked) == 0 || session.marked[0] < 0 || session.marked[len(session.marked)-1] != 49 {
+		t.Fatalf("marked = %v", session.marked)
+	}
+}
+
+func TestConsumeConcurrentlyRedelivers(t *testing.T) {
+	redeliveryInterval = 0
+	var mu sync.Mutex
+	fails := 2
+	c := &Consumer{workers: 4, cb: func(msg model.ConsumerMsg) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		if msg.Offset == 5 && fails > 0 {
+			fails--
+			return false
+		}
+		return true
+	}}
+
+	session := &fakeSession{ctx: context.Background()}
+	claim := &fakeClaim{msgs: make(chan *sarama.ConsumerMessage, 100)}
+	keys := []string{"a", "b", "c", "d", "e"}
+	for i := int64(0); i < 50; i++ {
+		claim.msgs <- &sarama.ConsumerMessage{Topic: "unios-alarm-std", Key: []byte(keys[i%5]), Offset: i}
+	}
+	close(claim.msgs)
+	if err := c.ConsumeClaim(session, claim); err != nil {
+		t.Fatal(err)
+	}
+	if fails != 0 || len(session.marked) == 0 || session.marked[len(session.marked)-1] != 49 {
+		t.Fatalf("fails = %d, marked = %v", fails, session.marked)
+	}
+}
+
+func TestConsumeConcurrentlyStopsOnFailure(t *testing.T) {
+	redeliveryInterval = 0
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var attempts int32
+	c := &Consumer{workers: 4, cb: func(msg model.ConsumerMsg) bool {
+		if msg.Offset == 5 && atomic.AddInt32(&attempts, 1) > 5 {
+			// 一直失败直到会话结束
+			cancel()
+		}
+		return msg.Offset != 5
+	}}
+
+	session := &fakeSession{ctx: ctx}
+	claim := &fakeClaim{msgs: make(chan *sarama.ConsumerMessage, 100)}
+	keys := []string{"a", "b", "c", "d", "e"}
+	for i := int64(0); i < 50; i++ {
+		claim.msgs <- &sarama.ConsumerMessage{Topic: "unios-alarm-std", Key: []byte(keys[i%5]), Offset: i}
+	}
+	close(claim.msgs)
+	if err := c.ConsumeClaim(session, claim); err != nil {
+		t.Fatal(err)
+	}
+	for _, offset := range session.marked {
+		if offset >= 5 {
+			t.Fatalf("marked past failed message: %v", session.marked)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"github.com/jifuy/commongo/mq/model"
+	"sort"
+	"time"
+)
+
+var (
+	errTopicExists  = errors.New("memory: topic already exists")
+	errUnknownTopic = errors.New("memory: unknown topic")
+)
+
+func NewMemoryAdmin(config Config) (*MQMemory, func() error, error) {
+	m := newMemory(config)
+	return m, m.close, nil
+}
+
+// CreateTopic 按 Partitions 创建 topic, 保留时间和配置只记录不生效
+func (m *MQMemory) CreateTopic(_ context.Context, spec model.TopicSpec) error {
+	b := m.Broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return errClosed
+	}
+	if _, ok := b.topics[spec.Name]; ok {
+		return errTopicExists
+	}
+	t := b.topic(spec.Name, int(spec.Partitions))
+	t.retention = spec.Retention
+	if len(spec.Configs) > 0 {
+		t.configs = make(map[string]string, len(spec.Configs))
+		for k, v := range spec.Configs {
+			t.configs[k] = v
+		}
+	}
+	return nil
+}
+
+// DeleteTopic 删除 topic 和全部消息, 订阅的消费者不再收到消息
+func (m *MQMemory) DeleteTopic(_ context.Context, name string) error {
+	b := m.Broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t, ok := b.topics[name]
+	if !ok {
+		return errUnknownTopic
+	}
+	delete(b.topics, name)
+	for _, g := range t.groups {
+		g.members = nil
+	}
+	b.cond.Broadcast()
+	return nil
+}
+
+func (m *MQMemory) DescribeTopic(_ context.Context, name string) (model.TopicSpec, error) {
+	b := m.Broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t, ok := b.topics[name]
+	if !ok {
+		return model.TopicSpec{}, errUnknownTopic
+	}
+	spec := model.TopicSpec{Name: name, Partitions: int32(len(t.partitions)), Replication: 1, Retention: t.retention}
+	if len(t.configs) > 0 {
+		spec.Configs = make(map[string]string, len(t.configs))
+		for k, v := range t.configs {
+			spec.Configs[k] = v
+		}
+	}
+	return spec, nil
+}
+
+// SetPartitions 增加分区数, 不能减少; 已有的消费组从新分区的开头消费
+func (m *MQMemory) SetPartitions(_ context.Context, name string, count int32) error {
+	b := m.Broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t, ok := b.topics[name]
+	if !ok {
+		return errUnknownTopic
+	}
+	if int(count) < len(t.partitions) {
+		return errors.New("memory: partition count can only be increased")
+	}
+	for len(t.partitions) < int(count) {
+		t.partitions = append(t.partitions, nil)
+		for _, g := range t.groups {
+			g.offsets = append(g.offsets, 0)
+			g.running = append(g.running, false)
+		}
+	}
+	for _, g := range t.groups {
+		if len(g.members) > 0 {
+			b.start(t, g)
+		}
+	}
+	return nil
+}
+
+func (m *MQMemory) SetRetention(_ context.Context, name string, retention time.Duration) error {
+	b := m.Broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t, ok := b.topics[name]
+	if !ok {
+		return errUnknownTopic
+	}
+	t.retention = retention
+	return nil
+}
+
+// ListGroups 返回全部 topic 上的消费组, 按名称排序
+func (m *MQMemory) ListGroups(_ context.Context) ([]string, error) {
+	b := m.Broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	seen := make(map[string]bool)
+	var names []string
+	for _, t := range b.topics {
+		for name := range t.groups {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// GroupLag 返回消费组在各分区上尚未确认的消息数
+func (m *MQMemory) GroupLag(_ context.Context, group string) ([]model.PartitionLag, error) {
+	b := m.Broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var lags []model.PartitionLag
+	for name, t := range b.topics {
+		g, ok := t.groups[group]
+		if !ok {
+			continue
+		}
+		for p, msgs := range t.partitions {
+			end := int64(len(msgs))
+			lags = append(lags, model.PartitionLag{Topic: name, Partition: int32(p), Committed: g.offsets[p], End: end, Lag: end - g.offsets[p]})
+		}
+	}
+	return lags, nil
+}
@@ -0,0 +1,261 @@
+package memory
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jifuy/commongo/mq/model"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+var errClosed = errors.New("memory: broker closed")
+
+type Config struct {
+	Name       string        // broker 名称, 同名的生产者和消费者共享消息, 为空时使用默认 broker
+	Partitions int           // 新建 topic 的分区数, 默认 1
+	Oldest     bool          // 消费者时 新的消费组从最早的消息开始消费, 否则只消费之后发送的消息
+	Redelivery time.Duration // 消费者时 回调返回 false 后重新投递的间隔, 默认 100ms
+}
+
+// Broker 进程内的消息队列, 按 topic 保存全部消息, 消费组按分区记录已确认的偏移量
+type Broker struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	topics map[string]*topic
+	closed bool
+}
+
+type topic struct {
+	partitions [][]model.ConsumerMsg
+	groups     map[string]*group
+	next       int // 无 key 消息轮询分区
+
+	retention time.Duration // 只记录, 不清理消息
+	configs   map[string]string
+}
+
+type group struct {
+	offsets []int64 // 每个分区下一条待确认消息的偏移量
+	members []*member
+	running []bool // 分区投递协程是否在运行, 成员全部退出后停止
+
+	redelivery time.Duration
+}
+
+type member struct {
+	f        func(b model.ConsumerMsg) bool
+	inflight sync.WaitGroup // 处理中的回调, 包括回调后的偏移量提交
+}
+
+var (
+	brokersMu sync.Mutex
+	brokers   = make(map[string]*Broker)
+)
+
+// NewBroker 创建独立的 broker, 不在名称表中注册
+func NewBroker() *Broker {
+	b := &Broker{topics: make(map[string]*topic)}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// GetBroker 返回名称对应的 broker, 不存在时创建
+func GetBroker(name string) *Broker {
+	brokersMu.Lock()
+	defer brokersMu.Unlock()
+	b, ok := brokers[name]
+	if !ok {
+		b = NewBroker()
+		brokers[name] = b
+	}
+	return b
+}
+
+// Close 关闭 broker, 停止全部投递并从名称表中移除
+func (b *Broker) Close() {
+	brokersMu.Lock()
+	for name, v := range brokers {
+		if v == b {
+			delete(brokers, name)
+		}
+	}
+	brokersMu.Unlock()
+
+	b.mu.Lock()
+	b.closed = true
+	b.mu.Unlock()
+	b.cond.Broadcast()
+}
+
+// Pending 返回消费组在 topic 上尚未确认的消息数
+func (b *Broker) Pending(topicName, groupName string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t, ok := b.topics[topicName]
+	if !ok {
+		return 0
+	}
+	g, ok := t.groups[groupName]
+	if !ok {
+		n := 0
+		for _, p := range t.partitions {
+			n += len(p)
+		}
+		return n
+	}
+	n := 0
+	for i, p := range t.partitions {
+		n += len(p) - int(g.offsets[i])
+	}
+	return n
+}
+
+// topic 返回 topic, 不存在时按 partitions 个分区创建, 调用方持有 b.mu
+func (b *Broker) topic(name string, partitions int) *topic {
+	t, ok := b.topics[name]
+	if !ok {
+		if partitions <= 0 {
+			partitions = 1
+		}
+		t = &topic{partitions: make([][]model.ConsumerMsg, partitions), groups: make(map[string]*group)}
+		b.topics[name] = t
+	}
+	return t
+}
+
+// publish 追加消息, key 非空时按 key 的哈希选择分区, 否则轮询
+func (b *Broker) publish(m *model.Message, partitions int) (int32, int64, error) {
+	name, key := m.Topic, m.Key
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return 0, 0, errClosed
+	}
+	t := b.topic(name, partitions)
+	var p int
+	if key != "" {
+		h := fnv.New32a()
+		h.Write([]byte(key))
+		p = int(h.Sum32() % uint32(len(t.partitions)))
+	} else {
+		p = t.next % len(t.partitions)
+		t.next++
+	}
+	msg := model.ConsumerMsg{
+		Value:     append([]byte(nil), m.Value...),
+		Partition: int32(p),
+		Offset:    int64(len(t.partitions[p])),
+		Topic:     name,
+		Key:       key,
+		Tags:      m.Tags,
+		Timestamp: m.Timestamp,
+		MessageID: m.MessageID,
+	}
+	if len(m.Headers) > 0 {
+		msg.Headers = make(map[string]string, len(m.Headers))
+		for k, v := range m.Headers {
+			msg.Headers[k] = v
+		}
+	}
+	if msg.Timestamp.IsZero() {
+		msg.Timestamp = time.Now()
+	}
+	if msg.MessageID == "" {
+		msg.MessageID = fmt.Sprintf("%s-%d-%d", name, msg.Partition, msg.Offset)
+	}
+	t.partitions[p] = append(t.partitions[p], msg)
+	b.cond.Broadcast()
+	return msg.Partition, msg.Offset, nil
+}
+
+// join 加入消费组, 组内成员按加入顺序分配分区
+func (b *Broker) join(name, groupName string, m *member, config Config) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return errClosed
+	}
+	t := b.topic(name, config.Partitions)
+	g, ok := t.groups[groupName]
+	if !ok {
+		g = &group{offsets: make([]int64, len(t.partitions)), running: make([]bool, len(t.partitions))}
+		if !config.Oldest {
+			for i, p := range t.partitions {
+				g.offsets[i] = int64(len(p))
+			}
+		}
+		t.groups[groupName] = g
+	}
+	g.members = append(g.members, m)
+	g.redelivery = config.Redelivery
+	if g.redelivery <= 0 {
+		g.redelivery = 100 * time.Millisecond
+	}
+	b.start(t, g)
+	return nil
+}
+
+// start 为没有投递协程的分区启动投递, 调用方持有 b.mu
+func (b *Broker) start(t *topic, g *group) {
+	for p, running := range g.running {
+		if !running {
+			g.running[p] = true
+			go b.deliver(t, g, p, g.redelivery)
+		}
+	}
+	b.cond.Broadcast()
+}
+
+func (b *Broker) leave(name, groupName string, m *member) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t, ok := b.topics[name]
+	if !ok {
+		return
+	}
+	g, ok := t.groups[groupName]
+	if !ok {
+		return
+	}
+	for i, v := range g.members {
+		if v == m {
+			g.members = append(g.members[:i:i], g.members[i+1:]...)
+			break
+		}
+	}
+	b.cond.Broadcast()
+}
+
+// deliver 按顺序投递分区 p 的消息, 回调返回 true 后提交偏移量, 返回 false 时等待后重新投递同一条消息
+func (b *Broker) deliver(t *topic, g *group, p int, redelivery time.Duration) {
+	for {
+		b.mu.Lock()
+		for !b.closed && len(g.members) > 0 && g.offsets[p] >= int64(len(t.partitions[p])) {
+			b.cond.Wait()
+		}
+		if b.closed || len(g.members) == 0 {
+			// 新成员加入时重新启动
+			g.running[p] = false
+			b.mu.Unlock()
+			return
+		}
+		offset := g.offsets[p]
+		msg := t.partitions[p][offset]
+		m := g.members[p%len(g.members)]
+		m.inflight.Add(1)
+		b.mu.Unlock()
+
+		if !m.f(msg) {
+			m.inflight.Done()
+			time.Sleep(redelivery)
+			continue
+		}
+		b.mu.Lock()
+		if g.offsets[p] == offset {
+			g.offsets[p] = offset + 1
+		}
+		b.mu.Unlock()
+		m.inflight.Done()
+	}
+}
@@ -0,0 +1,68 @@
+package memory
+
+import (
+	"context"
+	"github.com/jifuy/commongo/mq/model"
+	"sync"
+)
+
+func NewMemoryCustomer(config Config) (*MQMemory, func() error, error) {
+	m := newMemory(config)
+	return m, m.close, nil
+}
+
+// Consumer 消费者 同组成员分摊分区, 组不相同时都可以消费到; group 为空时使用随机组.
+// 回调返回 false 时不提交偏移量, 间隔 Redelivery 后重新投递同一条消息
+func (m *MQMemory) Consumer(topic, group, _ string, f func(b model.ConsumerMsg) bool) (func() error, error) {
+	if group == "" {
+		group = model.NewUUIDStr()
+	}
+	mb := &member{f: f}
+	if err := m.Broker.join(topic, group, mb, m.config); err != nil {
+		return nil, err
+	}
+	var once sync.Once
+	leave := func() {
+		once.Do(func() {
+			m.Broker.leave(topic, group, mb)
+		})
+	}
+	m.mu.Lock()
+	m.subs = append(m.subs, subscription{leave: leave, member: mb})
+	m.mu.Unlock()
+	return func() error {
+		leave()
+		mb.inflight.Wait()
+		return nil
+	}, nil
+}
+
+type subscription struct {
+	leave  func()
+	member *member
+}
+
+// Shutdown 退出全部消费组不再接收消息, 等待处理中的回调结束并提交偏移量.
+// ctx 结束时不再等待并返回 ctx.Err()
+func (m *MQMemory) Shutdown(ctx context.Context) error {
+	m.mu.Lock()
+	subs := m.subs
+	m.subs = nil
+	m.mu.Unlock()
+	for _, sub := range subs {
+		sub.leave()
+	}
+	done := make(chan struct{})
+	go func() {
+		for _, sub := range subs {
+			sub.member.inflight.Wait()
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,54 @@
+package memory
+
+import (
+	"context"
+	"github.com/jifuy/commongo/loging"
+	"github.com/jifuy/commongo/mq/model"
+	"sync"
+)
+
+// MQMemory 进程内消息队列, 用于单元测试和本地开发
+type MQMemory struct {
+	Broker *Broker
+	config Config
+
+	mu   sync.Mutex
+	subs []subscription
+}
+
+func newMemory(config Config) *MQMemory {
+	return &MQMemory{Broker: GetBroker(config.Name), config: config}
+}
+
+func NewMemoryProducer(config Config) (*MQMemory, func() error, error) {
+	m := newMemory(config)
+	return m, m.close, nil
+}
+
+// Producer 生产者 topickey 非空时按 key 哈希到固定分区保证顺序, 否则轮询分区
+func (m *MQMemory) Producer(topic string, key, _ string, data []byte) error {
+	return m.SendMessage(context.Background(), &model.Message{Topic: topic, Key: key, Value: data})
+}
+
+// SendMessage 发送带消息头的消息, 消费者收到的 ConsumerMsg 带有全部字段
+func (m *MQMemory) SendMessage(_ context.Context, msg *model.Message) error {
+	pid, offset, err := m.Broker.publish(msg, m.config.Partitions)
+	if err != nil {
+		loging.Error("send msg failed, err:", err)
+		return err
+	}
+	loging.Debugf("pid:%v offset:%v\n", pid, offset)
+	return nil
+}
+
+// close 取消通过该对象建立的全部订阅, 不等待处理中的回调
+func (m *MQMemory) close() error {
+	m.mu.Lock()
+	subs := m.subs
+	m.subs = nil
+	m.mu.Unlock()
+	for _, sub := range subs {
+		sub.leave()
+	}
+	return nil
+}
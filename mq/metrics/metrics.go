@@ -0,0 +1,38 @@
+package metrics
+
+import "time"
+
+// Metrics 消息队列的消费和发送指标, 实现必须并发安全
+type Metrics interface {
+	// Consumed 一条消息处理完成, ok 为回调结果, latency 为回调耗时
+	Consumed(topic string, partition int32, latency time.Duration, ok bool)
+	// Lag 消费组在分区上提交位置与最新偏移量的差
+	Lag(topic, group string, partition int32, lag int64)
+	// Sent 一条消息发送完成, err 不为空表示发送失败
+	Sent(topic string, latency time.Duration, err error)
+}
+
+// DuplicateRecorder Metrics 的可选实现, 记录消费去重跳过的消息
+type DuplicateRecorder interface {
+	// Duplicate 消费组收到已处理过的消息, 未进入回调
+	Duplicate(topic, group string)
+}
+
+// Nop 不记录任何指标, 未配置 Metrics 时使用
+var Nop Metrics = nop{}
+
+type nop struct{}
+
+func (nop) Consumed(string, int32, time.Duration, bool) {}
+
+func (nop) Lag(string, string, int32, int64) {}
+
+func (nop) Sent(string, time.Duration, error) {}
+
+// OrNop m 为空时返回 Nop
+func OrNop(m Metrics) Metrics {
+	if m == nil {
+		return Nop
+	}
+	return m
+}
@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"strconv"
+	"time"
+)
+
+// Prometheus 以 Prometheus 指标导出, 通过 promhttp.Handler 暴露
+type Prometheus struct {
+	consumed *prometheus.CounterVec
+	failed   *prometheus.CounterVec
+	latency  *prometheus.HistogramVec
+	lag      *prometheus.GaugeVec
+	sent     *prometheus.CounterVec
+	sendErr  *prometheus.CounterVec
+	sendTime *prometheus.HistogramVec
+	dup      *prometheus.CounterVec
+}
+
+// NewPrometheus 创建并注册指标, namespace 为指标名前缀, reg 为空时注册到 prometheus.DefaultRegisterer
+func NewPrometheus(namespace string, reg prometheus.Registerer) (*Prometheus, error) {
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+	p := &Prometheus{
+		consumed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Subsystem: "mq", Name: "consumed_total", Help: "Messages handled by consumer callbacks.",
+		}, []string{"topic", "partition"}),
+		failed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Subsystem: "mq", Name: "consume_failed_total", Help: "Consumer callbacks that returned failure.",
+		}, []string{"topic", "partition"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace, Subsystem: "mq", Name: "consume_seconds", Help: "Consumer callback latency.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"topic"}),
+		lag: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace, Subsystem: "mq", Name: "consumer_lag", Help: "High-water mark minus committed offset.",
+		}, []string{"topic", "group", "partition"}),
+		sent: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Subsystem: "mq", Name: "sent_total", Help: "Messages sent by producers.",
+		}, []string{"topic"}),
+		sendErr: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Subsystem: "mq", Name: "send_failed_total", Help: "Producer sends that failed.",
+		}, []string{"topic"}),
+		sendTime: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace, Subsystem: "mq", Name: "send_seconds", Help: "Producer send latency until acknowledged.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"topic"}),
+		dup: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Subsystem: "mq", Name: "duplicates_total", Help: "Duplicate messages suppressed before consumer callbacks.",
+		}, []string{"topic", "group"}),
+	}
+	for _, c := range []prometheus.Collector{p.consumed, p.failed, p.latency, p.lag, p.sent, p.sendErr, p.sendTime, p.dup} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+func (p *Prometheus) Consumed(topic string, partition int32, latency time.Duration, ok bool) {
+	part := strconv.Itoa(int(partition))
+	p.consumed.WithLabelValues(topic, part).Inc()
+	if !ok {
+		p.failed.WithLabelValues(topic, part).Inc()
+	}
+	p.latency.WithLabelValues(topic).Observe(latency.Seconds())
+}
+
+func (p *Prometheus) Lag(topic, group string, partition int32, lag int64) {
+	p.lag.WithLabelValues(topic, group, strconv.Itoa(int(partition))).Set(float64(lag))
+}
+
+func (p *Prometheus) Sent(topic string, latency time.Duration, err error) {
+	p.sent.WithLabelValues(topic).Inc()
+	if err != nil {
+		p.sendErr.WithLabelValues(topic).Inc()
+	}
+	p.sendTime.WithLabelValues(topic).Observe(latency.Seconds())
+}
+
+func (p *Prometheus) Duplicate(topic, group string) {
+	p.dup.WithLabelValues(topic, group).Inc()
+}
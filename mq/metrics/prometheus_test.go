@@ -0,0 +1,24 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"testing"
+)
+
+func TestPrometheusDuplicate(t *testing.T) {
+	p, err := NewPrometheus("unios", prometheus.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m Metrics = p
+	dup, ok := m.(DuplicateRecorder)
+	if !ok {
+		t.Fatal("Prometheus does not implement DuplicateRecorder")
+	}
+	dup.Duplicate("unios-alarm-std", "group1")
+	dup.Duplicate("unios-alarm-std", "group1")
+	if n := testutil.ToFloat64(p.dup.WithLabelValues("unios-alarm-std", "group1")); n != 2 {
+		t.Fatalf("duplicates_total = %v", n)
+	}
+}
@@ -0,0 +1,27 @@
+package model
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrUnsupported broker 不支持的管理操作
+var ErrUnsupported = errors.New("mq: operation not supported")
+
+// TopicSpec 创建 topic 的参数, 也是查询 topic 的结果
+type TopicSpec struct {
+	Name        string
+	Partitions  int32             // 分区数, rocket 为队列数, 默认 1
+	Replication int16             // 副本数, 默认 1, rocket 不支持
+	Retention   time.Duration     // 消息保留时间, 0 为 broker 默认
+	Configs     map[string]string // 其他 topic 配置, 查询时只返回非默认值
+}
+
+// PartitionLag 消费组在一个分区上的积压
+type PartitionLag struct {
+	Topic     string
+	Partition int32
+	Committed int64 // 已提交的偏移量, 没有提交时为 -1
+	End       int64 // 分区最新偏移量
+	Lag       int64
+}
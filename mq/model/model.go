@@ -1,7 +1,65 @@
 package model
 
+import (
+	"context"
+	"time"
+)
+
+// 没有原生字段的 broker 用以下消息头传递 MessageID 和 Tags
+const (
+	HeaderMessageID = "x-message-id"
+	HeaderTags      = "x-tags"
+)
+
+// TypedProducer 写入的消息体格式
+const (
+	HeaderContentType     = "content-type"
+	HeaderContentEncoding = "content-encoding"
+)
+
 type ConsumerMsg struct {
 	Value     []byte
 	Partition int32
 	Offset    int64
+
+	Topic     string
+	Key       string
+	Headers   map[string]string // kafka 记录头, rocket 用户属性, rabbit 消息头
+	Tags      string            // rocket 的 tag
+	Timestamp time.Time
+	MessageID string // 优先取消息头 x-message-id, 没有时为 rocket msgId、rabbit messageId, kafka 为 topic-分区-偏移量
+
+	// Context kafka 消费会话的 context, 重平衡或停止消费时结束, 回调中的等待应随之返回; 其他 broker 为空
+	Context context.Context
+}
+
+// Message 发送的消息
+type Message struct {
+	Topic     string // rabbit 为交换机
+	Key       string // kafka 分区键, rocket 的 keys 和分片键, rabbit 路由键
+	Value     []byte
+	Headers   map[string]string // 用于传递 trace id、租户 id 等
+	Tags      string            // rocket 的 tag, 其他 broker 放在消息头 x-tags 中
+	Timestamp time.Time         // 为空时使用发送时间
+	MessageID string            // rabbit 的 message id, 其他 broker 放在消息头 x-message-id 中
+
+	DelayLevel int       // rocket 延时等级 1-18, 对应 1s 5s 10s 30s 1m ... 2h, 0 不延时
+	DeliverAt  time.Time // rocket 5.x 定时消息的投递时间, 为空或已过期时立即投递, 同时设置时优先于 DelayLevel
+}
+
+// BatchOptions 批量消费的攒批条件, 满足任一条件即回调
+type BatchOptions struct {
+	MaxCount int           // 每批最多消息数, 默认 100
+	MaxWait  time.Duration // 收到第一条消息后最长等待时间, 默认 1s; rocket 不支持, 每次拉取后立即回调
+}
+
+// WithDefaults 返回补全默认值后的选项
+func (o BatchOptions) WithDefaults() BatchOptions {
+	if o.MaxCount <= 0 {
+		o.MaxCount = 100
+	}
+	if o.MaxWait <= 0 {
+		o.MaxWait = time.Second
+	}
+	return o
 }
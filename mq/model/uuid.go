@@ -0,0 +1,11 @@
+package model
+
+import (
+	uuid "github.com/satori/go.uuid"
+	"strings"
+)
+
+// NewUUIDStr 生成去掉 - 的 uuid, 用于随机的消费组、实例名和消息 id
+func NewUUIDStr() string {
+	return strings.ReplaceAll(uuid.NewV4().String(), "-", "")
+}
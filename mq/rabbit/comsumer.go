@@ -0,0 +1,190 @@
+package rabbit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jifuy/commongo/loging"
+	"github.com/jifuy/commongo/mq/model"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func NewRabbitCustomer(config Config) (*MQRabbit, func() error, error) {
+	r, err := newRabbit(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	return r, r.close, nil
+}
+
+// Consumer 消费者 topic 为交换机名称, group 为队列名, routekey 为绑定键(topic 交换机为空时绑定 #).
+// group 为空时使用服务端命名的独占队列, 每个消费者都能收到全部消息.
+// 回调返回 true 时确认消息, 返回 false 时按 Requeue 配置拒绝; 连接断开后自动重连并重新订阅
+func (r *MQRabbit) Consumer(topic, group, routekey string, f func(b model.ConsumerMsg) bool) (func() error, error) {
+	// 首次订阅同步进行, 声明失败等配置错误直接返回
+	ch, deliveries, err := r.subscribe(topic, group, routekey)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	r.mu.Lock()
+	r.subs = append(r.subs, subscription{cancel: cancel, done: done})
+	r.mu.Unlock()
+	go func() {
+		defer close(done)
+		for {
+			r.handle(ctx, deliveries, f)
+			ch.Close()
+			if ctx.Err() != nil {
+				return
+			}
+			loging.Errorf("Rabbit consumer of %s closed, attempting to reconnect...", topic)
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(r.config.ReconnectDelay):
+				}
+				if ch, deliveries, err = r.subscribe(topic, group, routekey); err == nil {
+					break
+				}
+				loging.Errorf("Failed to reconnect to rabbit, retrying...: %v", err)
+			}
+		}
+	}()
+
+	return func() error {
+		cancel()
+		<-done
+		return nil
+	}, nil
+}
+
+// subscription 后台消费协程, cancel 后 done 在协程退出时关闭
+type subscription struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Shutdown 停止接收投递, 等待处理中的回调完成确认后关闭连接, 未确认的预取消息由 broker 重新入队.
+// ctx 结束时不再等待, 直接关闭连接并返回 ctx.Err()
+func (r *MQRabbit) Shutdown(ctx context.Context) error {
+	r.mu.Lock()
+	subs := r.subs
+	r.subs = nil
+	r.mu.Unlock()
+	for _, sub := range subs {
+		sub.cancel()
+	}
+	var err error
+wait:
+	for _, sub := range subs {
+		select {
+		case <-sub.done:
+		case <-ctx.Done():
+			err = ctx.Err()
+			break wait
+		}
+	}
+	if e := r.close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+// subscribe 在新通道上声明交换机和队列并开始消费
+func (r *MQRabbit) subscribe(exchange, queue, key string) (*amqp.Channel, <-chan amqp.Delivery, error) {
+	r.mu.Lock()
+	conn, err := r.connection()
+	r.mu.Unlock()
+	if err != nil {
+		return nil, nil, err
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, nil, err
+	}
+	deliveries, err := r.declareAndConsume(ch, exchange, queue, key)
+	if err != nil {
+		ch.Close()
+		return nil, nil, err
+	}
+	return ch, deliveries, nil
+}
+
+func (r *MQRabbit) declareAndConsume(ch *amqp.Channel, exchange, queue, key string) (<-chan amqp.Delivery, error) {
+	if err := ch.Qos(r.config.Prefetch, 0, false); err != nil {
+		return nil, err
+	}
+	if err := r.declareExchange(ch, exchange); err != nil {
+		return nil, err
+	}
+	exclusive := queue == ""
+	q, err := ch.QueueDeclare(queue, r.config.Durable && !exclusive, r.config.AutoDelete || exclusive, exclusive, false, nil)
+	if err != nil {
+		return nil, err
+	}
+	if exchange != "" {
+		if key == "" && r.config.ExchangeType == amqp.ExchangeTopic {
+			key = "#"
+		}
+		if err = ch.QueueBind(q.Name, key, exchange, false, nil); err != nil {
+			return nil, err
+		}
+	}
+	return ch.Consume(q.Name, "", false, exclusive, false, false, nil)
+}
+
+// handle 处理投递直到通道关闭或取消订阅
+func (r *MQRabbit) handle(ctx context.Context, deliveries <-chan amqp.Delivery, f func(b model.ConsumerMsg) bool) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case d, ok := <-deliveries:
+			if !ok {
+				return
+			}
+			if f(toConsumerMsg(d)) {
+				if err := d.Ack(false); err != nil {
+					loging.Errorf("rabbit ack failed: %v", err)
+				}
+				continue
+			}
+			// 如果回调函数返回 false，拒绝消息
+			loging.Warnf("Callback returned false, rejecting message. exchange:%s, key:%s, requeue:%v", d.Exchange, d.RoutingKey, r.config.Requeue)
+			if err := d.Nack(false, r.config.Requeue); err != nil {
+				loging.Errorf("rabbit nack failed: %v", err)
+			}
+		}
+	}
+}
+
+func toConsumerMsg(d amqp.Delivery) model.ConsumerMsg {
+	msg := model.ConsumerMsg{
+		Value:     d.Body,
+		Offset:    int64(d.DeliveryTag),
+		Topic:     d.Exchange,
+		Key:       d.RoutingKey,
+		Timestamp: d.Timestamp,
+		MessageID: d.MessageId,
+	}
+	if len(d.Headers) > 0 {
+		msg.Headers = make(map[string]string, len(d.Headers))
+		for k, v := range d.Headers {
+			if b, ok := v.([]byte); ok {
+				msg.Headers[k] = string(b)
+			} else {
+				msg.Headers[k] = fmt.Sprint(v)
+			}
+		}
+		msg.Tags = msg.Headers[model.HeaderTags]
+		if id := msg.Headers[model.HeaderMessageID]; id != "" {
+			msg.MessageID = id
+		}
+	}
+	return msg
+}
@@ -0,0 +1,228 @@
+package mq
+
+import (
+	"context"
+	"fmt"
+	"github.com/jifuy/commongo/loging"
+	"github.com/jifuy/commongo/mq/model"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 死信消息附带的失败信息
+const (
+	HeaderDLQTopic     = "x-dlq-topic"     // 原 topic, 重放时据此发回
+	HeaderDLQPartition = "x-dlq-partition" // 原分区
+	HeaderDLQOffset    = "x-dlq-offset"    // 原偏移量
+	HeaderDLQRetries   = "x-dlq-retries"   // 已重试次数
+	HeaderDLQTime      = "x-dlq-time"      // 进入死信的时间 RFC3339
+	HeaderDLQError     = "x-dlq-error"     // 无法解码等直接进入死信的原因
+)
+
+// RetryCfg 消费回调返回 false 时的重试策略, 重试耗尽后发送到死信 topic
+type RetryCfg struct {
+	MaxRetries            int    // 进程内重试次数, 不含第一次
+	BackoffMilliSecond    int    // 首次重试间隔, 之后翻倍, 默认 100
+	MaxBackoffMilliSecond int    // 重试间隔上限, 默认 10000
+	DeadLetterTopic       string // 死信 topic, {topic} 替换为原 topic, 例如 {topic}.DLQ; 为空时不发送死信
+}
+
+func (c RetryCfg) enabled() bool {
+	return c.MaxRetries > 0 || c.DeadLetterTopic != ""
+}
+
+// WithRetry 包装消费回调: 失败时按退避间隔重试, 耗尽后通过 dlq 发送到死信 topic, 发送成功视为消费成功.
+// 死信发送失败或未配置死信时返回 false, 由各 broker 按自身语义处理. 消息的 Context 结束时停止等待并返回 false
+func WithRetry(cfg RetryCfg, dlq IProducer, f func(b model.ConsumerMsg) bool) func(b model.ConsumerMsg) bool {
+	return withRetry(context.Background(), cfg, dlq, f)
+}
+
+// withRetry ctx 为消费者的生命周期, 关闭消费者时结束退避等待
+func withRetry(ctx context.Context, cfg RetryCfg, dlq IProducer, f func(b model.ConsumerMsg) bool) func(b model.ConsumerMsg) bool {
+	backoff := time.Duration(cfg.BackoffMilliSecond) * time.Millisecond
+	if backoff <= 0 {
+		backoff = 100 * time.Millisecond
+	}
+	maxBackoff := time.Duration(cfg.MaxBackoffMilliSecond) * time.Millisecond
+	if maxBackoff <= 0 {
+		maxBackoff = 10 * time.Second
+	}
+	return func(b model.ConsumerMsg) bool {
+		if f(b) {
+			return true
+		}
+		session := b.Context
+		if session == nil {
+			session = context.Background()
+		}
+		wait := backoff
+		for i := 1; i <= cfg.MaxRetries; i++ {
+			t := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return false
+			case <-session.Done():
+				t.Stop()
+				return false
+			case <-t.C:
+			}
+			if f(b) {
+				return true
+			}
+			if wait *= 2; wait > maxBackoff {
+				wait = maxBackoff
+			}
+		}
+		if cfg.DeadLetterTopic == "" || dlq == nil {
+			loging.Warnf("Callback failed after %d retries, topic:%s, partition:%d, offset:%d", cfg.MaxRetries, b.Topic, b.Partition, b.Offset)
+			return false
+		}
+		msg := deadLetter(b, strings.ReplaceAll(cfg.DeadLetterTopic, "{topic}", b.Topic), cfg.MaxRetries)
+		if err := sendMessage(session, dlq, msg); err != nil {
+			loging.Errorf("send dead letter to %s failed: %v", msg.Topic, err)
+			return false
+		}
+		return true
+	}
+}
+
+func deadLetter(b model.ConsumerMsg, topic string, retries int) *model.Message {
+	headers := make(map[string]string, len(b.Headers)+5)
+	for k, v := range b.Headers {
+		headers[k] = v
+	}
+	headers[HeaderDLQTopic] = b.Topic
+	headers[HeaderDLQPartition] = strconv.Itoa(int(b.Partition))
+	headers[HeaderDLQOffset] = strconv.FormatInt(b.Offset, 10)
+	headers[HeaderDLQRetries] = strconv.Itoa(retries)
+	headers[HeaderDLQTime] = time.Now().Format(time.RFC3339)
+	return &model.Message{Topic: topic, Key: b.Key, Value: b.Value, Headers: headers, Tags: b.Tags, MessageID: b.MessageID}
+}
+
+// ReplayDeadLetter 消费死信 topic, 按 x-dlq-topic 把消息发回原 topic, 直到 ctx 结束, 返回重发的条数.
+// 没有 x-dlq-topic 的消息跳过
+func ReplayDeadLetter(ctx context.Context, cus ICustomer, p IProducer, dlqTopic, group string) (int, error) {
+	var n int64
+	stop, err := cus.Consumer(dlqTopic, group, "", func(b model.ConsumerMsg) bool {
+		topic := b.Headers[HeaderDLQTopic]
+		if topic == "" {
+			loging.Warnf("dead letter without %s, skipped. offset:%d", HeaderDLQTopic, b.Offset)
+			return true
+		}
+		headers := make(map[string]string, len(b.Headers))
+		for k, v := range b.Headers {
+			if !strings.HasPrefix(k, "x-dlq-") {
+				headers[k] = v
+			}
+		}
+		msg := &model.Message{Topic: topic, Key: b.Key, Value: b.Value, Headers: headers, Tags: b.Tags, MessageID: b.MessageID}
+		if err := sendMessage(ctx, p, msg); err != nil {
+			loging.Errorf("replay dead letter to %s failed: %v", topic, err)
+			return false
+		}
+		atomic.AddInt64(&n, 1)
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+	<-ctx.Done()
+	err = stop()
+	return int(atomic.LoadInt64(&n)), err
+}
+
+// retryCustomer 为每个订阅包装 WithRetry, 关闭时先结束退避等待
+type retryCustomer struct {
+	ICustomer
+	cfg    RetryCfg
+	dlq    *lazyProducer
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func (c retryCustomer) Consumer(topic, group, routekey string, f func(b model.ConsumerMsg) bool) (func() error, error) {
+	return c.ICustomer.Consumer(topic, group, routekey, withRetry(c.ctx, c.cfg, c.dlq, f))
+}
+
+// ConsumeBatch 批量回调不做重试包装, 失败的批次由各 broker 重新投递
+func (c retryCustomer) ConsumeBatch(topic, group string, opts model.BatchOptions, f func(msgs []model.ConsumerMsg) error) (func() error, error) {
+	b, ok := c.ICustomer.(IBatchCustomer)
+	if !ok {
+		return nil, fmt.Errorf("mq: %T does not support ConsumeBatch", c.ICustomer)
+	}
+	return b.ConsumeBatch(topic, group, opts, f)
+}
+
+// ConsumeTransform 失败时由底层消费者重试同一条消息, 不做重试包装
+func (c retryCustomer) ConsumeTransform(topic string, f func(msg model.ConsumerMsg) ([]*model.Message, error)) (func() error, error) {
+	t, ok := c.ICustomer.(ITransformCustomer)
+	if !ok {
+		return nil, fmt.Errorf("mq: %T does not support ConsumeTransform", c.ICustomer)
+	}
+	return t.ConsumeTransform(topic, f)
+}
+
+// Shutdown 关闭底层消费者后关闭死信生产者
+func (c retryCustomer) Shutdown(ctx context.Context) error {
+	c.cancel()
+	var err error
+	if s, ok := c.ICustomer.(Shutdowner); ok {
+		err = s.Shutdown(ctx)
+	}
+	if e := c.dlq.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+// lazyProducer 发送死信的生产者, 第一次发送时创建, 创建失败时下次重试
+type lazyProducer struct {
+	cfg   MqCfg
+	mu    sync.Mutex
+	p     IProducer
+	close func() error
+}
+
+func (l *lazyProducer) get() (IProducer, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.p == nil {
+		p, closeFn, err := NewProducerMQ(l.cfg)
+		if err != nil {
+			return nil, err
+		}
+		l.p, l.close = p, closeFn
+	}
+	return l.p, nil
+}
+
+func (l *lazyProducer) Producer(topic string, topickey string, routekey string, data []byte) error {
+	p, err := l.get()
+	if err != nil {
+		return err
+	}
+	return p.Producer(topic, topickey, routekey, data)
+}
+
+func (l *lazyProducer) SendMessage(ctx context.Context, msg *model.Message) error {
+	p, err := l.get()
+	if err != nil {
+		return err
+	}
+	return sendMessage(ctx, p, msg)
+}
+
+func (l *lazyProducer) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.close == nil {
+		return nil
+	}
+	err := l.close()
+	l.p, l.close = nil, nil
+	return err
+}
@@ -0,0 +1,101 @@
+package rocket
+
+import (
+	"context"
+	"github.com/apache/rocketmq-client-go/v2/admin"
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/jifuy/commongo/mq/model"
+	"github.com/pkg/errors"
+	"strings"
+	"time"
+)
+
+// MQRocketAdmin RocketMQ topic 和消费组管理, 不支持副本数、保留时间和消费积压
+type MQRocketAdmin struct {
+	A          admin.Admin
+	brokerAddr string
+}
+
+func NewRocketAdmin(config Config) (*MQRocketAdmin, func() error, error) {
+	ops := []admin.AdminOption{admin.WithResolver(primitive.NewPassthroughResolver(strings.Split(config.Brokers, ",")))}
+	if config.PassWord != "" {
+		ops = append(ops, admin.WithCredentials(primitive.Credentials{
+			AccessKey: config.UserName,
+			SecretKey: config.PassWord,
+		}))
+	}
+	a, err := admin.NewAdmin(ops...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &MQRocketAdmin{A: a, brokerAddr: config.BrokerAddr}, a.Close, nil
+}
+
+// CreateTopic 在 BrokerAddr 上创建 topic, Partitions 为读写队列数, 已存在时更新队列数
+func (m *MQRocketAdmin) CreateTopic(ctx context.Context, spec model.TopicSpec) error {
+	if spec.Replication > 1 || spec.Retention > 0 || len(spec.Configs) > 0 {
+		return errors.Wrap(model.ErrUnsupported, "rocket topic replication/retention/configs")
+	}
+	if m.brokerAddr == "" {
+		return errors.New("rocket admin: BrokerAddr is required to create topic")
+	}
+	queues := int(spec.Partitions)
+	if queues <= 0 {
+		queues = 1
+	}
+	return m.A.CreateTopic(ctx,
+		admin.WithTopicCreate(spec.Name),
+		admin.WithBrokerAddrCreate(m.brokerAddr),
+		admin.WithReadQueueNums(queues),
+		admin.WithWriteQueueNums(queues),
+	)
+}
+
+// DeleteTopic 从 broker 和 nameserver 删除 topic
+func (m *MQRocketAdmin) DeleteTopic(ctx context.Context, name string) error {
+	ops := []admin.OptionDelete{admin.WithTopicDelete(name)}
+	if m.brokerAddr != "" {
+		ops = append(ops, admin.WithBrokerAddrDelete(m.brokerAddr))
+	}
+	return m.A.DeleteTopic(ctx, ops...)
+}
+
+// DescribeTopic 查询可写队列数
+func (m *MQRocketAdmin) DescribeTopic(ctx context.Context, name string) (model.TopicSpec, error) {
+	queues, err := m.A.FetchPublishMessageQueues(ctx, name)
+	if err != nil {
+		return model.TopicSpec{}, err
+	}
+	return model.TopicSpec{Name: name, Partitions: int32(len(queues))}, nil
+}
+
+// SetPartitions 修改读写队列数
+func (m *MQRocketAdmin) SetPartitions(ctx context.Context, name string, count int32) error {
+	return m.CreateTopic(ctx, model.TopicSpec{Name: name, Partitions: count})
+}
+
+// SetRetention 保留时间是 broker 级配置 fileReservedTime, 不支持按 topic 设置
+func (m *MQRocketAdmin) SetRetention(_ context.Context, _ string, _ time.Duration) error {
+	return model.ErrUnsupported
+}
+
+// ListGroups 查询 BrokerAddr 上的订阅组
+func (m *MQRocketAdmin) ListGroups(ctx context.Context) ([]string, error) {
+	if m.brokerAddr == "" {
+		return nil, errors.New("rocket admin: BrokerAddr is required to list groups")
+	}
+	wrapper, err := m.A.GetAllSubscriptionGroup(ctx, m.brokerAddr, 3*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(wrapper.SubscriptionGroupTable))
+	for name := range wrapper.SubscriptionGroupTable {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// GroupLag 客户端管理接口没有查询消费进度的命令
+func (m *MQRocketAdmin) GroupLag(_ context.Context, _ string) ([]model.PartitionLag, error) {
+	return nil, model.ErrUnsupported
+}
@@ -6,48 +6,30 @@ import (
 	"github.com/apache/rocketmq-client-go/v2/consumer"
 	"github.com/apache/rocketmq-client-go/v2/primitive"
 	"github.com/jifuy/commongo/loging"
-	"github.com/jifuy/commongo/mq/kafka"
+	"github.com/jifuy/commongo/mq/metrics"
 	"github.com/jifuy/commongo/mq/model"
 	"github.com/pkg/errors"
+	"strconv"
 	"strings"
+	"time"
 )
 
 func NewRocketCustomer(config Config) (MQRocket, func() error, error) {
-	options := make([]consumer.Option, 0)
 	addr, err := primitive.NewNamesrvAddr(strings.Split(config.Brokers, ",")...)
 	if err != nil {
 		return MQRocket{}, nil, err
 	}
-	options = append(options, consumer.WithNameServer(addr))
-
 	if config.Group == "" {
 		return MQRocket{}, nil, errors.Wrapf(err, "消费组不能为空 %s", config.Group)
 	}
-	options = append(options, consumer.WithGroupName(config.Group))
-
-	if config.PassWord != "" {
-		options = append(options, consumer.WithCredentials(
-			primitive.Credentials{
-				AccessKey: config.UserName,
-				SecretKey: config.PassWord,
-			}))
-	}
 	if config.MaxSpan == 0 {
 		config.MaxSpan = 2000
 	}
-	options = append(options, consumer.WithConsumeConcurrentlyMaxSpan(config.MaxSpan))
-
 	if config.InstanceName == "" {
-		config.InstanceName = kafka.NewUUIDStr()
-	}
-	options = append(options, consumer.WithInstance(config.InstanceName))
-
-	if config.MsgMod == consumer.BroadCasting.String() {
-		options = append(options, consumer.WithConsumerModel(consumer.BroadCasting))
+		config.InstanceName = model.NewUUIDStr()
 	}
-
 	// 消费者连接
-	com, err := rocketmq.NewPushConsumer(options...)
+	com, err := rocketmq.NewPushConsumer(consumerOptions(addr, config)...)
 	if err != nil {
 		loging.Error("消费者连接失败！")
 		return MQRocket{}, nil, err
@@ -57,22 +39,155 @@ func NewRocketCustomer(config Config) (MQRocket, func() error, error) {
 		loging.Error("消费者启动失败！")
 		return MQRocket{}, nil, err
 	}
-	return MQRocket{C: com},
+	return MQRocket{C: com, config: config, subs: &subscriptions{}},
 		func() error {
 			return com.Shutdown()
 		}, nil
 }
 
-func (r MQRocket) Consumer(topic, _, _ string, f func(b model.ConsumerMsg) bool) (func() error, error) {
-	err := r.C.Subscribe(topic, consumer.MessageSelector{}, func(ctx context.Context, ext ...*primitive.MessageExt) (consumer.ConsumeResult, error) {
+func consumerOptions(addr primitive.NamesrvAddr, config Config) []consumer.Option {
+	options := make([]consumer.Option, 0)
+	options = append(options, consumer.WithNameServer(addr))
+	options = append(options, consumer.WithGroupName(config.Group))
+
+	if config.PassWord != "" {
+		options = append(options, consumer.WithCredentials(
+			primitive.Credentials{
+				AccessKey: config.UserName,
+				SecretKey: config.PassWord,
+			}))
+	}
+	options = append(options, consumer.WithConsumeConcurrentlyMaxSpan(config.MaxSpan))
+	options = append(options, consumer.WithInstance(config.InstanceName))
+
+	if config.MsgMod == consumer.BroadCasting.String() {
+		options = append(options, consumer.WithConsumerModel(consumer.BroadCasting))
+	}
+	if config.Orderly {
+		options = append(options, consumer.WithConsumerOrder(true))
+	}
+	return options
+}
+
+// selector 把 routekey 转为订阅的过滤表达式, 为空时订阅全部 tag
+func selector(routekey, typ string) consumer.MessageSelector {
+	if routekey == "" {
+		return consumer.MessageSelector{Type: consumer.TAG, Expression: "*"}
+	}
+	if strings.EqualFold(typ, string(consumer.SQL92)) {
+		return consumer.MessageSelector{Type: consumer.SQL92, Expression: routekey}
+	}
+	return consumer.MessageSelector{Type: consumer.TAG, Expression: routekey}
+}
+
+// retryLater 消费失败的返回值, 顺序消费时暂停当前队列后重试, 否则稍后重新投递
+func retryLater(config Config) consumer.ConsumeResult {
+	if config.Orderly {
+		return consumer.SuspendCurrentQueueAMoment
+	}
+	return consumer.ConsumeRetryLater
+}
+
+// Consumer 消费者 routekey 为 tag 或 SQL92 过滤表达式, 按 SelectorType 解析, 为空时消费全部消息.
+// 返回的函数取消订阅并等待处理中的回调结束
+func (r MQRocket) Consumer(topic, _, routekey string, f func(b model.ConsumerMsg) bool) (func() error, error) {
+	g := &gate{}
+	err := r.C.Subscribe(topic, selector(routekey, r.config.SelectorType), func(ctx context.Context, ext ...*primitive.MessageExt) (consumer.ConsumeResult, error) {
+		if !g.enter() {
+			// 已取消订阅, 稍后重新投递
+			return retryLater(r.config), nil
+		}
+		defer g.leave()
 		for _, i := range ext {
-			if ok := f(model.ConsumerMsg{Value: i.Body, Offset: i.QueueOffset, Partition: int32(i.Queue.QueueId)}); !ok {
-				loging.Error("消费失败")
+			start := time.Now()
+			ok := f(toConsumerMsg(i))
+			observe(r.config.Metrics, r.config.Group, i, time.Since(start), ok)
+			if !ok {
+				// 回调返回 false 时稍后重新投递, 超过最大重试次数后 broker 转入 %DLQ% 死信队列
+				loging.Errorf("消费失败, msgId:%s, reconsume:%d", i.MsgId, i.ReconsumeTimes)
+				return retryLater(r.config), nil
 			}
 		}
 		return consumer.ConsumeSuccess, nil
 	})
+	if err != nil {
+		return nil, err
+	}
+	sub := &subscription{gate: g, unsubscribe: func() error { return r.C.Unsubscribe(topic) }}
+	r.subs.add(sub)
+	return func() error {
+		return r.subs.stop(context.Background(), sub)
+	}, nil
+}
+
+// ConsumeBatch 批量消费 每次回调最多 MaxCount 条消息, 为一次拉取到的消息, 不等待攒满; 不支持 MaxWait.
+// 使用独立的 PushConsumer, group 为空时使用配置中的 Group + "-batch-" + topic, 避免与同组的其他订阅关系冲突;
+// 回调返回错误时整批稍后重新投递
+func (r MQRocket) ConsumeBatch(topic, group string, opts model.BatchOptions, f func(msgs []model.ConsumerMsg) error) (func() error, error) {
+	opts = opts.WithDefaults()
+	config := r.config
+	if group == "" {
+		group = config.Group + "-batch-" + topic
+	}
+	config.Group = group
+	config.InstanceName += "-batch-" + topic
+	addr, err := primitive.NewNamesrvAddr(strings.Split(config.Brokers, ",")...)
+	if err != nil {
+		return nil, err
+	}
+	options := append(consumerOptions(addr, config),
+		consumer.WithConsumeMessageBatchMaxSize(opts.MaxCount),
+		consumer.WithPullBatchSize(int32(opts.MaxCount)),
+	)
+	com, err := rocketmq.NewPushConsumer(options...)
+	if err != nil {
+		return nil, err
+	}
+	g := &gate{}
+	err = com.Subscribe(topic, selector("", config.SelectorType), func(ctx context.Context, ext ...*primitive.MessageExt) (consumer.ConsumeResult, error) {
+		if !g.enter() {
+			return retryLater(config), nil
+		}
+		defer g.leave()
+		msgs := make([]model.ConsumerMsg, 0, len(ext))
+		for _, i := range ext {
+			msgs = append(msgs, toConsumerMsg(i))
+		}
+		start := time.Now()
+		err := f(msgs)
+		for _, i := range ext {
+			observe(config.Metrics, config.Group, i, time.Since(start), err == nil)
+		}
+		if err != nil {
+			loging.Errorf("批量消费失败, topic:%s, count:%d, err:%v", topic, len(msgs), err)
+			return retryLater(config), nil
+		}
+		return consumer.ConsumeSuccess, nil
+	})
+	if err != nil {
+		com.Shutdown()
+		return nil, err
+	}
+	if err = com.Start(); err != nil {
+		com.Shutdown()
+		return nil, err
+	}
+	sub := &subscription{gate: g, unsubscribe: func() error { return com.Unsubscribe(topic) }, release: com.Shutdown}
+	r.subs.add(sub)
 	return func() error {
-		return nil
-	}, err
+		return r.subs.stop(context.Background(), sub)
+	}, nil
+}
+
+// observe 记录一条消息的处理结果, 积压为拉取时队列最大偏移量与该消息之差
+func observe(m metrics.Metrics, group string, msg *primitive.MessageExt, latency time.Duration, ok bool) {
+	mt := metrics.OrNop(m)
+	var queue int32
+	if msg.Queue != nil {
+		queue = int32(msg.Queue.QueueId)
+	}
+	mt.Consumed(msg.Topic, queue, latency, ok)
+	if max, err := strconv.ParseInt(msg.GetProperty(primitive.PropertyMaxOffset), 10, 64); err == nil {
+		mt.Lag(msg.Topic, group, queue, max-msg.QueueOffset-1)
+	}
 }
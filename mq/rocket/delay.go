@@ -0,0 +1,40 @@
+package rocket
+
+import (
+	"context"
+	"github.com/jifuy/commongo/mq/model"
+	"time"
+)
+
+// delayLevels broker 默认的延时等级, 下标加 1 为等级
+var delayLevels = []time.Duration{
+	time.Second, 5 * time.Second, 10 * time.Second, 30 * time.Second,
+	time.Minute, 2 * time.Minute, 3 * time.Minute, 4 * time.Minute, 5 * time.Minute,
+	6 * time.Minute, 7 * time.Minute, 8 * time.Minute, 9 * time.Minute, 10 * time.Minute,
+	20 * time.Minute, 30 * time.Minute, time.Hour, 2 * time.Hour,
+}
+
+// delayLevel 返回与 d 相差不超过 1s 的延时等级, 没有时返回 0
+func delayLevel(d time.Duration) int {
+	for i, l := range delayLevels {
+		if diff := d - l; diff > -time.Second && diff < time.Second {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// ProduceAt 在 when 时投递到 topic, when 已过期时立即发送.
+// 配置 Timer 时使用定时消息, 否则只支持与延时等级一致的延时, 其他时间返回 model.ErrUnsupported
+func (m MQRocket) ProduceAt(topic string, msg *model.Message, when time.Time) error {
+	c := *msg
+	c.Topic = topic
+	if d := time.Until(when); d > 0 {
+		if m.config.Timer {
+			c.DeliverAt = when
+		} else if c.DelayLevel = delayLevel(d); c.DelayLevel == 0 {
+			return model.ErrUnsupported
+		}
+	}
+	return m.SendMessage(context.TODO(), &c)
+}
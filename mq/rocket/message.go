@@ -0,0 +1,60 @@
+package rocket
+
+import (
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/jifuy/commongo/mq/model"
+	"strconv"
+	"time"
+)
+
+// PropertyTimerDeliverMs rocket 5.x 定时消息的投递时间属性, 毫秒时间戳; 4.x 的 broker 忽略该属性, 立即投递
+const PropertyTimerDeliverMs = "TIMER_DELIVER_MS"
+
+// toRocketMessage 把 model.Message 转为 rocket 消息, Headers 作为用户属性, Key 同时作为 keys 和分片键
+func toRocketMessage(msg *model.Message) *primitive.Message {
+	m := primitive.NewMessage(msg.Topic, msg.Value)
+	if len(msg.Headers) > 0 {
+		// rocket 直接保存传入的 map 并在其中写入系统属性, 复制一份避免修改调用方的 Headers
+		props := make(map[string]string, len(msg.Headers)+4)
+		for k, v := range msg.Headers {
+			props[k] = v
+		}
+		m.WithProperties(props)
+	}
+	if msg.Key != "" {
+		m.WithKeys([]string{msg.Key})
+	}
+	m.WithShardingKey(msg.Key)
+	if msg.Tags != "" {
+		m.WithTag(msg.Tags)
+	}
+	if msg.MessageID != "" {
+		m.WithProperty(model.HeaderMessageID, msg.MessageID)
+	}
+	if !msg.DeliverAt.IsZero() && msg.DeliverAt.After(time.Now()) {
+		m.WithProperty(PropertyTimerDeliverMs, strconv.FormatInt(msg.DeliverAt.UnixMilli(), 10))
+	} else if msg.DelayLevel > 0 {
+		m.WithDelayTimeLevel(msg.DelayLevel)
+	}
+	return m
+}
+
+func toConsumerMsg(ext *primitive.MessageExt) model.ConsumerMsg {
+	msg := model.ConsumerMsg{
+		Value:     ext.Body,
+		Offset:    ext.QueueOffset,
+		Topic:     ext.Topic,
+		Key:       ext.GetKeys(),
+		Headers:   ext.GetProperties(),
+		Tags:      ext.GetTags(),
+		Timestamp: time.UnixMilli(ext.BornTimestamp),
+		MessageID: ext.GetProperty(model.HeaderMessageID),
+	}
+	if ext.Queue != nil {
+		msg.Partition = int32(ext.Queue.QueueId)
+	}
+	if msg.MessageID == "" {
+		msg.MessageID = ext.MsgId
+	}
+	return msg
+}
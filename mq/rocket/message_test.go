@@ -0,0 +1,60 @@
+package rocket
+
+import (
+	"github.com/apache/rocketmq-client-go/v2/consumer"
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/jifuy/commongo/mq/model"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSelector(t *testing.T) {
+	cases := []struct {
+		routekey, typ string
+		want          consumer.MessageSelector
+	}{
+		{"", "", consumer.MessageSelector{Type: consumer.TAG, Expression: "*"}},
+		{"alarm || event", "", consumer.MessageSelector{Type: consumer.TAG, Expression: "alarm || event"}},
+		{"level > 2", "sql92", consumer.MessageSelector{Type: consumer.SQL92, Expression: "level > 2"}},
+	}
+	for _, c := range cases {
+		if got := selector(c.routekey, c.typ); got != c.want {
+			t.Errorf("selector(%q, %q) = %+v, want %+v", c.routekey, c.typ, got, c.want)
+		}
+	}
+}
+
+func TestToRocketMessageDelay(t *testing.T) {
+	m := toRocketMessage(&model.Message{Topic: "unios-alarm-std", Key: "k1", Tags: "alarm", DelayLevel: 3})
+	if got := m.GetProperty(primitive.PropertyDelayTimeLevel); got != "3" {
+		t.Fatalf("delay level = %q, want 3", got)
+	}
+	if m.GetTags() != "alarm" || m.GetShardingKey() != "k1" {
+		t.Fatalf("tags = %q, sharding key = %q", m.GetTags(), m.GetShardingKey())
+	}
+
+	at := time.Now().Add(time.Minute)
+	m = toRocketMessage(&model.Message{Topic: "unios-alarm-std", DelayLevel: 3, DeliverAt: at})
+	if got := m.GetProperty(PropertyTimerDeliverMs); got != strconv.FormatInt(at.UnixMilli(), 10) {
+		t.Fatalf("deliver ms = %q", got)
+	}
+	if got := m.GetProperty(primitive.PropertyDelayTimeLevel); got != "" {
+		t.Fatalf("delay level = %q, want empty when DeliverAt is set", got)
+	}
+}
+
+func TestDelayLevel(t *testing.T) {
+	cases := map[time.Duration]int{
+		time.Second:                          1,
+		10*time.Minute - 10*time.Millisecond: 14,
+		15 * time.Minute:                     0,
+		2 * time.Hour:                        18,
+		3 * time.Hour:                        0,
+	}
+	for d, want := range cases {
+		if got := delayLevel(d); got != want {
+			t.Errorf("delayLevel(%v) = %d, want %d", d, got, want)
+		}
+	}
+}
@@ -6,44 +6,44 @@ import (
 	"github.com/apache/rocketmq-client-go/v2/primitive"
 	"github.com/apache/rocketmq-client-go/v2/producer"
 	"github.com/jifuy/commongo/loging"
-	"github.com/jifuy/commongo/mq/kafka"
+	"github.com/jifuy/commongo/mq/metrics"
+	"github.com/jifuy/commongo/mq/model"
 	"github.com/pkg/errors"
 	"strings"
+	"time"
 )
 
 type Config struct {
 	Brokers  string
 	UserName string
 	PassWord string
-	Group    string //消费组
+	Group    string //消费组, 事务生产者时为生产者组
 
 	InstanceName string
 	MsgMod       string //消息模式  BroadCasting/Clustering
 	MaxSpan      int
+	Orderly      bool   // 消费者时 顺序消费, 同一队列(同一分片键)的消息逐条处理, 失败时暂停该队列后重试
+	SelectorType string // 消费者时 routekey 的过滤方式 TAG/SQL92, 默认 TAG, 例如 a || b 或 a > 5 AND b = 'x'
+
+	Metrics metrics.Metrics // 消费和发送指标, 为空时不记录
+	Timer   bool            // 生产者时 broker 为 5.x, ProduceAt 使用定时消息, 否则只支持固定延时等级
+
+	BrokerAddr string // 管理接口时 创建 topic 和查询消费组的 broker 地址, 例如 127.0.0.1:10911
 }
 
 type MQRocket struct {
 	C rocketmq.PushConsumer
 	P rocketmq.Producer
+
+	config Config
+	subs   *subscriptions // 消费者时 全部订阅, Shutdown 时取消
 }
 
 func NewRocketProducer(config Config) (MQRocket, func() error, error) {
-	ops := make([]producer.Option, 0)
-	ops = append(ops, producer.WithNsResolver(primitive.NewPassthroughResolver(strings.Split(config.Brokers, ","))))
-	ops = append(ops, producer.WithRetry(2))
-	ops = append(ops, producer.WithQueueSelector(producer.NewHashQueueSelector()))
-
 	if config.InstanceName == "" {
-		config.InstanceName = kafka.NewUUIDStr()
-	}
-	ops = append(ops, producer.WithInstanceName(config.InstanceName))
-
-	if config.PassWord != "" {
-		ops = append(ops, producer.WithCredentials(primitive.Credentials{
-			AccessKey: config.UserName,
-			SecretKey: config.PassWord,
-		}))
+		config.InstanceName = model.NewUUIDStr()
 	}
+	ops := producerOptions(config)
 	// 连接kafka
 	pclient, err := rocketmq.NewProducer(ops...)
 	if err != nil {
@@ -52,17 +52,47 @@ func NewRocketProducer(config Config) (MQRocket, func() error, error) {
 	if err = pclient.Start(); err != nil {
 		return MQRocket{}, nil, errors.Wrapf(err, "start rocket producer failed, broker %s", config.Brokers)
 	}
-	return MQRocket{P: pclient},
+	return MQRocket{P: pclient, config: config},
 		func() error {
 			return pclient.Shutdown()
 		}, nil
 }
 
-// Producer 生产者
-func (m MQRocket) Producer(topic string, key, _ string, data []byte) error {
+func producerOptions(config Config) []producer.Option {
+	ops := make([]producer.Option, 0)
+	ops = append(ops, producer.WithNsResolver(primitive.NewPassthroughResolver(strings.Split(config.Brokers, ","))))
+	ops = append(ops, producer.WithRetry(2))
+	ops = append(ops, producer.WithQueueSelector(producer.NewHashQueueSelector()))
+	ops = append(ops, producer.WithInstanceName(config.InstanceName))
+
+	if config.PassWord != "" {
+		ops = append(ops, producer.WithCredentials(primitive.Credentials{
+			AccessKey: config.UserName,
+			SecretKey: config.PassWord,
+		}))
+	}
+	return ops
+}
+
+// Producer 生产者 key 为分片键, 同一分片键的消息发送到同一队列; routekey 为 tag
+func (m MQRocket) Producer(topic string, key, routekey string, data []byte) error {
 	msg := primitive.NewMessage(topic, data)
 	msg.WithProperty(primitive.PropertyShardingKey, key)
-	res, err := m.P.SendSync(context.TODO(), msg)
+	if routekey != "" {
+		msg.WithTag(routekey)
+	}
+	return m.send(context.TODO(), msg)
+}
+
+// SendMessage 发送带属性和 tag 的消息, DelayLevel 或 DeliverAt 非空时为延时消息
+func (m MQRocket) SendMessage(ctx context.Context, msg *model.Message) error {
+	return m.send(ctx, toRocketMessage(msg))
+}
+
+func (m MQRocket) send(ctx context.Context, msg *primitive.Message) error {
+	start := time.Now()
+	res, err := m.P.SendSync(ctx, msg)
+	metrics.OrNop(m.config.Metrics).Sent(msg.Topic, time.Since(start), err)
 	if err != nil {
 		return errors.Wrapf(err, "send to ctg-mq failed")
 	}
@@ -0,0 +1,131 @@
+package rocket
+
+import (
+	"context"
+	"sync"
+)
+
+// gate 记录处理中的回调, 关闭后拒绝新的回调
+type gate struct {
+	mu     sync.Mutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+func (g *gate) enter() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closed {
+		return false
+	}
+	g.wg.Add(1)
+	return true
+}
+
+func (g *gate) leave() {
+	g.wg.Done()
+}
+
+func (g *gate) close() {
+	g.mu.Lock()
+	g.closed = true
+	g.mu.Unlock()
+}
+
+// wait 等待处理中的回调结束
+func (g *gate) wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type subscription struct {
+	gate        *gate
+	unsubscribe func() error
+	release     func() error // 批量消费的独立消费者, 回调结束后关闭以持久化偏移量
+}
+
+type subscriptions struct {
+	mu   sync.Mutex
+	list []*subscription
+}
+
+func (s *subscriptions) add(sub *subscription) {
+	s.mu.Lock()
+	s.list = append(s.list, sub)
+	s.mu.Unlock()
+}
+
+func (s *subscriptions) remove(sub *subscription) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, v := range s.list {
+		if v == sub {
+			s.list = append(s.list[:i:i], s.list[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// stop 取消一个订阅, 已取消时不做处理
+func (s *subscriptions) stop(ctx context.Context, sub *subscription) error {
+	if !s.remove(sub) {
+		return nil
+	}
+	return shutdown(ctx, []*subscription{sub})
+}
+
+// shutdown 先取消全部订阅停止拉取, 再等待处理中的回调结束
+func shutdown(ctx context.Context, subs []*subscription) error {
+	var err error
+	for _, sub := range subs {
+		sub.gate.close()
+		if e := sub.unsubscribe(); err == nil {
+			err = e
+		}
+	}
+	var waitErr error
+	for _, sub := range subs {
+		// ctx 结束后不再等待, 仍然关闭独立消费者
+		if waitErr == nil {
+			waitErr = sub.gate.wait(ctx)
+		}
+		if sub.release != nil {
+			if e := sub.release(); err == nil {
+				err = e
+			}
+		}
+	}
+	if waitErr != nil {
+		return waitErr
+	}
+	return err
+}
+
+// Shutdown 取消全部订阅, 等待处理中的回调结束后关闭消费者并持久化消费进度.
+// ctx 结束时不再等待, 直接关闭消费者并返回 ctx.Err()
+func (r MQRocket) Shutdown(ctx context.Context) error {
+	var err error
+	if r.subs != nil {
+		r.subs.mu.Lock()
+		subs := r.subs.list
+		r.subs.list = nil
+		r.subs.mu.Unlock()
+		err = shutdown(ctx, subs)
+	}
+	if r.C != nil {
+		if e := r.C.Shutdown(); err == nil {
+			err = e
+		}
+	}
+	return err
+}
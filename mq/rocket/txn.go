@@ -0,0 +1,152 @@
+package rocket
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/apache/rocketmq-client-go/v2"
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/apache/rocketmq-client-go/v2/producer"
+	"github.com/jifuy/commongo/loging"
+	"github.com/jifuy/commongo/mq/metrics"
+	"github.com/jifuy/commongo/mq/model"
+	"github.com/pkg/errors"
+	"sync"
+	"time"
+)
+
+// ErrTxUnknown 本地事务返回该错误时不提交也不回滚半消息, 由 broker 稍后回查
+var ErrTxUnknown = errors.New("rocket: local transaction state unknown")
+
+// TxCheck 回查本地事务: 返回 true 提交半消息, false 回滚; 返回错误时状态未知, broker 稍后再次回查
+type TxCheck func(msg model.ConsumerMsg) (bool, error)
+
+// MQRocketTxn 事务生产者 先发送半消息, 本地事务成功后提交, 失败后回滚
+type MQRocketTxn struct {
+	P rocketmq.TransactionProducer
+
+	config   Config
+	listener *txnListener
+}
+
+// NewRocketTxnProducer 创建事务生产者, config.Group 为生产者组, broker 向组内任一实例回查未决的事务.
+// check 为空时回查一律回滚
+func NewRocketTxnProducer(config Config, check TxCheck) (*MQRocketTxn, func() error, error) {
+	if config.InstanceName == "" {
+		config.InstanceName = model.NewUUIDStr()
+	}
+	ops := producerOptions(config)
+	if config.Group != "" {
+		ops = append(ops, producer.WithGroupName(config.Group))
+	}
+	l := &txnListener{check: check}
+	pclient, err := rocketmq.NewTransactionProducer(l, ops...)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = pclient.Start(); err != nil {
+		return nil, nil, errors.Wrapf(err, "start rocket transaction producer failed, broker %s", config.Brokers)
+	}
+	return &MQRocketTxn{P: pclient, config: config, listener: l}, pclient.Shutdown, nil
+}
+
+// SendInTransaction 发送半消息后执行 local, local 返回 nil 时提交消息, 返回错误时回滚并返回该错误;
+// 返回 ErrTxUnknown 时由 broker 回查决定
+func (t *MQRocketTxn) SendInTransaction(ctx context.Context, msg *model.Message, local func(ctx context.Context) error) error {
+	m := toRocketMessage(msg)
+	call := &txnCall{ctx: ctx, f: local}
+	t.listener.pending.Store(m, call)
+	defer t.listener.pending.Delete(m)
+
+	start := time.Now()
+	res, err := t.P.SendMessageInTransaction(ctx, m)
+	metrics.OrNop(t.config.Metrics).Sent(m.Topic, time.Since(start), err)
+	if err != nil {
+		return errors.Wrapf(err, "send half message to ctg-mq failed")
+	}
+	if call.err != nil {
+		return call.err
+	}
+	if res.State != primitive.CommitMessageState {
+		// 半消息未写入成功, 本地事务没有执行
+		return fmt.Errorf("rocket: half message not committed, status %d", res.Status)
+	}
+	loging.Debugf("send transaction message success: result=%s\n", res.String())
+	return nil
+}
+
+// SendInSQLTx 以数据库事务作为本地事务, db 可以是 dbClient.SetUpDb 返回的连接: f 在事务中执行,
+// f 返回 nil 且事务提交后提交消息. 提交数据库事务出错时结果不确定, 返回 ErrTxUnknown, 由回查决定
+func (t *MQRocketTxn) SendInSQLTx(ctx context.Context, db *sql.DB, msg *model.Message, f func(tx *sql.Tx) error) error {
+	return t.SendInTransaction(ctx, msg, func(ctx context.Context) error {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if err = f(tx); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err = tx.Commit(); err != nil {
+			return fmt.Errorf("%w: %v", ErrTxUnknown, err)
+		}
+		return nil
+	})
+}
+
+// CheckSQL 按消息 key 查询本地事务结果的回查, query 返回单个计数, 例如
+// select count(1) from alarm where alarm_id = ?, 大于 0 时提交
+func CheckSQL(db *sql.DB, query string) TxCheck {
+	return func(msg model.ConsumerMsg) (bool, error) {
+		var n int64
+		if err := db.QueryRow(query, msg.Key).Scan(&n); err != nil {
+			return false, err
+		}
+		return n > 0, nil
+	}
+}
+
+type txnCall struct {
+	ctx context.Context
+	f   func(ctx context.Context) error
+	err error
+}
+
+// txnListener 把 rocket 的事务回调转为 Go 函数, 发送中的本地事务按消息指针查找
+type txnListener struct {
+	check   TxCheck
+	pending sync.Map // *primitive.Message -> *txnCall
+}
+
+func (l *txnListener) ExecuteLocalTransaction(m *primitive.Message) primitive.LocalTransactionState {
+	v, ok := l.pending.Load(m)
+	if !ok {
+		return primitive.UnknowState
+	}
+	call := v.(*txnCall)
+	call.err = call.f(call.ctx)
+	switch {
+	case call.err == nil:
+		return primitive.CommitMessageState
+	case errors.Is(call.err, ErrTxUnknown):
+		loging.Warnf("local transaction state unknown, topic:%s, err:%v", m.Topic, call.err)
+		return primitive.UnknowState
+	default:
+		return primitive.RollbackMessageState
+	}
+}
+
+func (l *txnListener) CheckLocalTransaction(ext *primitive.MessageExt) primitive.LocalTransactionState {
+	if l.check == nil {
+		return primitive.RollbackMessageState
+	}
+	ok, err := l.check(toConsumerMsg(ext))
+	if err != nil {
+		loging.Errorf("check local transaction failed, msgId:%s, err:%v", ext.MsgId, err)
+		return primitive.UnknowState
+	}
+	if ok {
+		return primitive.CommitMessageState
+	}
+	return primitive.RollbackMessageState
+}
@@ -0,0 +1,64 @@
+package rocket
+
+import (
+	"context"
+	"errors"
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/jifuy/commongo/mq/model"
+	"testing"
+)
+
+// fakeTxnProducer 半消息总是写入成功, 同步执行本地事务并记录结果
+type fakeTxnProducer struct {
+	listener primitive.TransactionListener
+	states   []primitive.LocalTransactionState
+}
+
+func (p *fakeTxnProducer) Start() error    { return nil }
+func (p *fakeTxnProducer) Shutdown() error { return nil }
+
+func (p *fakeTxnProducer) SendMessageInTransaction(ctx context.Context, m *primitive.Message) (*primitive.TransactionSendResult, error) {
+	// 与 rocket 的事务生产者一样在消息属性中写入系统属性
+	m.WithProperty(primitive.PropertyTransactionPrepared, "true")
+	state := p.listener.ExecuteLocalTransaction(m)
+	p.states = append(p.states, state)
+	return &primitive.TransactionSendResult{SendResult: &primitive.SendResult{Status: primitive.SendOK, MessageQueue: &primitive.MessageQueue{Topic: m.Topic}}, State: state}, nil
+}
+
+func TestSendInTransaction(t *testing.T) {
+	l := &txnListener{check: func(msg model.ConsumerMsg) (bool, error) { return msg.Key == "a1", nil }}
+	p := &fakeTxnProducer{listener: l}
+	txn := &MQRocketTxn{P: p, listener: l}
+	msg := &model.Message{Topic: "unios-alarm-std", Key: "a1", Value: []byte("alarm"), Headers: map[string]string{"trace-id": "t1"}}
+	ctx := context.Background()
+
+	if err := txn.SendInTransaction(ctx, msg, func(ctx context.Context) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	errFail := errors.New("insert failed")
+	if err := txn.SendInTransaction(ctx, msg, func(ctx context.Context) error { return errFail }); err != errFail {
+		t.Fatalf("err = %v, want %v", err, errFail)
+	}
+	if err := txn.SendInTransaction(ctx, msg, func(ctx context.Context) error { return ErrTxUnknown }); !errors.Is(err, ErrTxUnknown) {
+		t.Fatalf("err = %v, want ErrTxUnknown", err)
+	}
+	// 调用方的 Headers 不被写入 rocket 的系统属性
+	if len(msg.Headers) != 1 || msg.Headers["trace-id"] != "t1" {
+		t.Fatalf("headers = %v", msg.Headers)
+	}
+	want := []primitive.LocalTransactionState{primitive.CommitMessageState, primitive.RollbackMessageState, primitive.UnknowState}
+	for i, s := range want {
+		if p.states[i] != s {
+			t.Fatalf("states = %v, want %v", p.states, want)
+		}
+	}
+
+	ext := &primitive.MessageExt{Message: *primitive.NewMessage("unios-alarm-std", nil).WithKeys([]string{"a1"})}
+	if s := l.CheckLocalTransaction(ext); s != primitive.CommitMessageState {
+		t.Fatalf("check = %v, want commit", s)
+	}
+	ext = &primitive.MessageExt{Message: *primitive.NewMessage("unios-alarm-std", nil).WithKeys([]string{"a2"})}
+	if s := l.CheckLocalTransaction(ext); s != primitive.RollbackMessageState {
+		t.Fatalf("check = %v, want rollback", s)
+	}
+}
@@ -0,0 +1,164 @@
+package mq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/jifuy/commongo/loging"
+	"github.com/jifuy/commongo/mq/model"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// DelayProducer 支持定时投递的生产者, 不支持的时间返回 model.ErrUnsupported
+type DelayProducer interface {
+	ProduceAt(topic string, msg *model.Message, when time.Time) error
+}
+
+// ScheduleStore 保存待投递消息的有序集合, *redisClient.RedisInfo 实现了该接口
+type ScheduleStore interface {
+	Zadd(key string, score int64, value string) error
+	ZrangebyscoreWithScores(key string, start, end int64) (map[string]string, error)
+	Zrem(key string, value string) (int, error)
+	Eval(script string, keys []string, args ...interface{}) (interface{}, error)
+}
+
+// ScheduleCfg 定时投递的配置
+type ScheduleCfg struct {
+	Key                  string // 有序集合的 key, 默认 mq:schedule
+	IntervalMilliSecond  int    // 扫描到期消息的间隔, 默认 1000
+	LeaseMilliSecond     int    // 领取到期消息后的租期, 租期内未发送成功的消息由其他实例重新领取, 默认 30000
+	DisableNativeProduce bool   // 不使用 broker 原生的延时消息, 全部保存到 store
+}
+
+// claimScript 消息仍然到期时把分数改为租约到期时间, 保证多个实例只有一个领取成功
+const claimScript = `
+local s = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if s and tonumber(s) <= tonumber(ARGV[2]) then
+	redis.call('ZADD', KEYS[1], ARGV[3], ARGV[1])
+	return 1
+end
+return 0`
+
+// Scheduler 定时投递消息: 生产者原生支持时直接发送, 否则保存到有序集合, 由 Run 在到期后发送到目标 topic.
+// 同一个 store 可以有多个实例同时 Run, 消息至少投递一次
+type Scheduler struct {
+	p     IProducer
+	store ScheduleStore
+	cfg   ScheduleCfg
+}
+
+// scheduled 有序集合中保存的消息, ID 保证相同内容的消息不会合并
+type scheduled struct {
+	ID        string            `json:"id"`
+	Topic     string            `json:"topic"`
+	Key       string            `json:"key,omitempty"`
+	Value     []byte            `json:"value"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Tags      string            `json:"tags,omitempty"`
+	MessageID string            `json:"messageId,omitempty"`
+}
+
+// NewScheduler store 为空时只能使用生产者原生的延时消息
+func NewScheduler(p IProducer, store ScheduleStore, cfg ScheduleCfg) *Scheduler {
+	if cfg.Key == "" {
+		cfg.Key = "mq:schedule"
+	}
+	if cfg.IntervalMilliSecond <= 0 {
+		cfg.IntervalMilliSecond = 1000
+	}
+	if cfg.LeaseMilliSecond <= 0 {
+		cfg.LeaseMilliSecond = 30000
+	}
+	return &Scheduler{p: p, store: store, cfg: cfg}
+}
+
+// ProduceAt 在 when 时把 msg 投递到 topic, when 已过期时立即发送
+func (s *Scheduler) ProduceAt(topic string, msg *model.Message, when time.Time) error {
+	if !when.After(time.Now()) {
+		c := *msg
+		c.Topic = topic
+		return sendMessage(context.Background(), s.p, &c)
+	}
+	if d, ok := s.p.(DelayProducer); ok && !s.cfg.DisableNativeProduce {
+		if err := d.ProduceAt(topic, msg, when); !errors.Is(err, model.ErrUnsupported) {
+			return err
+		}
+	}
+	if s.store == nil {
+		return model.ErrUnsupported
+	}
+	b, err := json.Marshal(scheduled{ID: model.NewUUIDStr(), Topic: topic, Key: msg.Key, Value: msg.Value,
+		Headers: msg.Headers, Tags: msg.Tags, MessageID: msg.MessageID})
+	if err != nil {
+		return err
+	}
+	return s.store.Zadd(s.cfg.Key, when.UnixMilli(), string(b))
+}
+
+// Run 按间隔扫描到期消息并发送, 直到 ctx 结束
+func (s *Scheduler) Run(ctx context.Context) error {
+	if s.store == nil {
+		return model.ErrUnsupported
+	}
+	t := time.NewTicker(time.Duration(s.cfg.IntervalMilliSecond) * time.Millisecond)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+			if _, err := s.poll(ctx); err != nil {
+				loging.Errorf("poll scheduled messages failed: %v", err)
+			}
+		}
+	}
+}
+
+// poll 按投递时间顺序领取并发送到期消息, 返回发送成功的条数; 发送失败的消息在租约到期后重试
+func (s *Scheduler) poll(ctx context.Context) (int, error) {
+	now := time.Now().UnixMilli()
+	due, err := s.store.ZrangebyscoreWithScores(s.cfg.Key, 0, now)
+	if err != nil {
+		return 0, err
+	}
+	members := make([]string, 0, len(due))
+	scores := make(map[string]int64, len(due))
+	for member, score := range due {
+		members = append(members, member)
+		scores[member], _ = strconv.ParseInt(score, 10, 64)
+	}
+	sort.Slice(members, func(i, j int) bool { return scores[members[i]] < scores[members[j]] })
+
+	n := 0
+	for _, member := range members {
+		if ctx.Err() != nil {
+			break
+		}
+		v, err := s.store.Eval(claimScript, []string{s.cfg.Key}, member, now, now+int64(s.cfg.LeaseMilliSecond))
+		if err != nil {
+			return n, err
+		}
+		if claimed, _ := v.(int64); claimed != 1 {
+			// 其他实例已领取
+			continue
+		}
+		var m scheduled
+		if err = json.Unmarshal([]byte(member), &m); err != nil {
+			loging.Errorf("drop invalid scheduled message %q: %v", member, err)
+			s.store.Zrem(s.cfg.Key, member)
+			continue
+		}
+		msg := &model.Message{Topic: m.Topic, Key: m.Key, Value: m.Value, Headers: m.Headers, Tags: m.Tags, MessageID: m.MessageID}
+		if err = sendMessage(ctx, s.p, msg); err != nil {
+			loging.Errorf("send scheduled message to %s failed: %v", m.Topic, err)
+			continue
+		}
+		if _, err = s.store.Zrem(s.cfg.Key, member); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
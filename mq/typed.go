@@ -0,0 +1,122 @@
+package mq
+
+import (
+	"context"
+	"fmt"
+	"github.com/jifuy/commongo/loging"
+	"github.com/jifuy/commongo/mq/codec"
+	"github.com/jifuy/commongo/mq/model"
+	"strings"
+)
+
+// TypedCfg 类型化生产者和消费者的编解码配置
+type TypedCfg struct {
+	Codec           codec.Codec     // 为空时使用 JSON
+	Compression     string          // 生产者时 压缩算法 gzip/snappy, 为空不压缩; 消费者按消息头解压
+	Registry        *codec.Registry // 按 topic 校验消息体, 为空时不校验
+	DeadLetterTopic string          // 消费者时 无法解码的消息发送到该 topic, {topic} 替换为原 topic; 为空时丢弃
+}
+
+func (c TypedCfg) codec() codec.Codec {
+	if c.Codec == nil {
+		return codec.JSON{}
+	}
+	return c.Codec
+}
+
+// TypedProducer 按 Codec 编码后发送 T, 消息头 content-type 和 content-encoding 标明格式; p 需要实现 MessageProducer
+type TypedProducer[T any] struct {
+	p   IProducer
+	cfg TypedCfg
+}
+
+func NewTypedProducer[T any](p IProducer, cfg TypedCfg) *TypedProducer[T] {
+	return &TypedProducer[T]{p: p, cfg: cfg}
+}
+
+// Send 编码 v 后发送到 topic, 不符合 schema 时返回错误不发送
+func (t *TypedProducer[T]) Send(ctx context.Context, topic, key string, v T) error {
+	return t.SendMessage(ctx, &model.Message{Topic: topic, Key: key}, v)
+}
+
+// SendMessage 编码 v 作为 msg 的消息体, msg 的其他字段原样发送
+func (t *TypedProducer[T]) SendMessage(ctx context.Context, msg *model.Message, v T) error {
+	c := t.cfg.codec()
+	b, err := c.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err = t.cfg.Registry.Validate(msg.Topic, b); err != nil {
+		return err
+	}
+	if b, err = codec.Compress(t.cfg.Compression, b); err != nil {
+		return err
+	}
+	m := *msg
+	m.Value = b
+	m.Headers = make(map[string]string, len(msg.Headers)+2)
+	for k, v := range msg.Headers {
+		m.Headers[k] = v
+	}
+	m.Headers[model.HeaderContentType] = c.ContentType()
+	if t.cfg.Compression != "" {
+		m.Headers[model.HeaderContentEncoding] = t.cfg.Compression
+	}
+	return sendMessage(ctx, t.p, &m)
+}
+
+// TypedConsumer 解码消息后回调, 无法解码或不符合 schema 的消息不进入回调
+type TypedConsumer[T any] struct {
+	c   ICustomer
+	dlq IProducer
+	cfg TypedCfg
+}
+
+// NewTypedConsumer dlq 为发送死信的生产者, 为空或未配置 DeadLetterTopic 时丢弃无法解码的消息
+func NewTypedConsumer[T any](c ICustomer, dlq IProducer, cfg TypedCfg) *TypedConsumer[T] {
+	return &TypedConsumer[T]{c: c, dlq: dlq, cfg: cfg}
+}
+
+// Consumer 订阅 topic, 参数同 ICustomer.Consumer
+func (t *TypedConsumer[T]) Consumer(topic, group, routekey string, f func(b model.ConsumerMsg, v T) bool) (func() error, error) {
+	return t.c.Consumer(topic, group, routekey, func(b model.ConsumerMsg) bool {
+		v, err := t.decode(b)
+		if err != nil {
+			return t.deadLetter(b, err)
+		}
+		return f(b, v)
+	})
+}
+
+// decode 按消息头解压, 校验后解码; 没有 content-type 时按配置的 Codec 解码
+func (t *TypedConsumer[T]) decode(b model.ConsumerMsg) (T, error) {
+	var v T
+	c := t.cfg.codec()
+	if ct := b.Headers[model.HeaderContentType]; ct != "" && ct != c.ContentType() {
+		return v, fmt.Errorf("content type %s, want %s", ct, c.ContentType())
+	}
+	data, err := codec.Decompress(b.Headers[model.HeaderContentEncoding], b.Value)
+	if err != nil {
+		return v, err
+	}
+	if err = t.cfg.Registry.Validate(b.Topic, data); err != nil {
+		return v, err
+	}
+	err = c.Unmarshal(data, &v)
+	return v, err
+}
+
+// deadLetter 无法解码的消息重试也不会成功, 发送死信或丢弃后确认
+func (t *TypedConsumer[T]) deadLetter(b model.ConsumerMsg, cause error) bool {
+	if t.cfg.DeadLetterTopic == "" || t.dlq == nil {
+		loging.Errorf("drop malformed message, topic:%s, partition:%d, offset:%d, err:%v", b.Topic, b.Partition, b.Offset, cause)
+		return true
+	}
+	msg := deadLetter(b, strings.ReplaceAll(t.cfg.DeadLetterTopic, "{topic}", b.Topic), 0)
+	msg.Headers[HeaderDLQError] = cause.Error()
+	if err := sendMessage(context.Background(), t.dlq, msg); err != nil {
+		loging.Errorf("send dead letter to %s failed: %v", msg.Topic, err)
+		return false
+	}
+	return true
+}
@@ -36,6 +36,25 @@ func (r *RedisInfo) Del(key string) error {
 	return nil
 }
 
+// SetNX key 不存在时写入并设置 ex 秒后过期, 返回是否写入
+func (r *RedisInfo) SetNX(key, value string, ex int) (bool, error) {
+	conn := r.Redis.Get()
+	defer conn.Close()
+	reply, err := conn.Do("SET", key, value, "NX", "EX", ex)
+	if err != nil {
+		return false, err
+	}
+	return reply != nil, nil
+}
+
+// SetEX 写入并设置 ex 秒后过期, key 已存在时覆盖值和过期时间
+func (r *RedisInfo) SetEX(key, value string, ex int) error {
+	conn := r.Redis.Get()
+	defer conn.Close()
+	_, err := conn.Do("SET", key, value, "EX", ex)
+	return err
+}
+
 func (r *RedisInfo) Hset(key, mapkey, field string) error {
 	conn := r.Redis.Get()
 	defer conn.Close()